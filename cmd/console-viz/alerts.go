@@ -0,0 +1,296 @@
+package main
+
+import (
+	"console-viz/collector"
+	"console-viz/draw"
+	"console-viz/styling"
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertHookTimeout is how long an --alert-command run may take before it is killed
+const alertHookTimeout = 30 * time.Second
+
+// alertColor marks firing lines and the border of panels with a firing rule
+const alertColor = styling.ColorRed
+
+// alerter evaluates the --alert rules against the live panels after every batch: firing lines
+// and their panel's border turn red, the banner under the widgets names the firing rules, and a
+// rule that starts or stops firing rings the bell and runs the hook when they are set
+type alerter struct {
+	rules   []*collector.Rule
+	bell    bool   // ring the terminal bell when a rule starts firing
+	command string // shell command run when a rule starts or stops firing
+	firing  map[alertKey]firingAlert
+	banner  *alertBanner
+	hooks   sync.WaitGroup
+}
+
+// alertKey is one rule firing for one line of a panel
+type alertKey struct {
+	rule  *collector.Rule
+	panel *sourcePanel
+	line  int
+}
+
+// firingAlert is what the banner and the hook say about a firing rule
+type firingAlert struct {
+	series string // the line's series, e.g. name{label="value"}
+	value  float64
+	since  time.Time // when the comparison started holding
+}
+
+// newAlerter parses the rules; it returns nil when there are none (a nil *alerter does nothing)
+func newAlerter(rules []string, bell bool, command string) (*alerter, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	a := &alerter{bell: bell, command: command, firing: map[alertKey]firingAlert{}, banner: &alertBanner{}}
+	for _, text := range rules {
+		rule, err := collector.ParseRule(text)
+		if err != nil {
+			return nil, err
+		}
+		a.rules = append(a.rules, rule)
+	}
+	return a, nil
+}
+
+// check evaluates the rules against a panel that just got a batch and signals what changed
+func (a *alerter) check(p *sourcePanel) {
+	if a == nil {
+		return
+	}
+	now := p.evaluate(a.rules)
+	lines := map[int]bool{}
+	for key, alert := range now {
+		lines[key.line] = true
+		if _, was := a.firing[key]; !was {
+			a.signal(key, alert, "firing")
+		}
+		a.firing[key] = alert
+	}
+	for key, alert := range a.firing {
+		if _, still := now[key]; key.panel == p && !still {
+			delete(a.firing, key)
+			a.signal(key, alert, "resolved")
+		}
+	}
+	p.highlight(lines)
+	a.banner.set(a.summary())
+}
+
+// signal rings the bell for a rule that starts firing and runs the hook for either transition
+// (the banner shows what fires; nothing is printed, the terminal belongs to the widgets)
+func (a *alerter) signal(key alertKey, alert firingAlert, state string) {
+	if a.bell && state == "firing" {
+		if err := draw.Bell(); err != nil {
+			log.Printf("alert bell: %v", err)
+		}
+	}
+	if a.command == "" {
+		return
+	}
+	env := append(os.Environ(),
+		"CONSOLE_VIZ_ALERT="+key.rule.Name,
+		"CONSOLE_VIZ_ALERT_STATE="+state,
+		"CONSOLE_VIZ_ALERT_RULE="+key.rule.String(),
+		"CONSOLE_VIZ_ALERT_SERIES="+alert.series,
+		"CONSOLE_VIZ_ALERT_VALUE="+formatValue(alert.value),
+	)
+	a.hooks.Go(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), alertHookTimeout)
+		defer cancel()
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+		cmd := exec.CommandContext(ctx, shell, flag, a.command)
+		cmd.Env = env
+		cmd.WaitDelay = time.Second
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("alert command for %s: %v %s", key.rule.Name, err, strings.TrimSpace(string(out)))
+		}
+	})
+}
+
+// warnHistory warns about rules that wait longer than a panel's history covers: Since only sees
+// the scrapes kept, so they could never fire there
+func (a *alerter) warnHistory(panels []*sourcePanel) {
+	if a == nil {
+		return
+	}
+	for _, rule := range a.rules {
+		var short []string
+		var span time.Duration
+		for _, p := range panels {
+			if p.span > 0 && rule.For > p.span {
+				short = append(short, p.defaultTitle())
+				span = max(span, p.span)
+			}
+		}
+		if len(short) == 0 {
+			continue
+		}
+		where := strings.Join(short, ", ")
+		if len(short) == len(panels) {
+			where = "every live widget"
+		}
+		log.Printf("Warning: alert %q waits %s but the history of %s covers at most %s, so it can't fire there (raise --history)",
+			rule.Name, rule.For, where, span)
+	}
+}
+
+// wait waits for running hooks (before a snapshot exits)
+func (a *alerter) wait() {
+	if a != nil {
+		a.hooks.Wait()
+	}
+}
+
+// summary is the banner text: every firing rule with the series it fires for, oldest first
+func (a *alerter) summary() string {
+	keys := make([]alertKey, 0, len(a.firing))
+	for key := range a.firing {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return a.firing[keys[i]].since.Before(a.firing[keys[j]].since)
+	})
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		alert := a.firing[key]
+		parts[i] = fmt.Sprintf("%s: %s = %s", key.rule.Name, alert.series, formatValue(alert.value))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " ALERT " + strings.Join(parts, " | ")
+}
+
+// formatValue prints a series value compactly
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+// evaluate returns the rules firing for each of the panel's lines
+func (m *sourcePanel) evaluate(rules []*collector.Rule) map[alertKey]firingAlert {
+	base := m.base()
+	base.Lock()
+	defer base.Unlock()
+	out := map[alertKey]firingAlert{}
+	if m.history.Len() == 0 {
+		return out
+	}
+	times := m.history.Times()
+	for i, sample := range m.series {
+		values := m.history.Series(i)
+		for _, rule := range rules {
+			if !rule.Matches(sample, m.groups[i]) || !rule.Firing(times, values) {
+				continue
+			}
+			since, _ := rule.Since(times, values)
+			out[alertKey{rule: rule, panel: m, line: i}] = firingAlert{series: sample.String(), value: values[len(values)-1], since: since}
+		}
+	}
+	return out
+}
+
+// highlight draws the firing lines (sparklines, the gauge bar) in the alert color and the border too
+// while any of them fire; the widget's own colors come back once none do
+func (m *sourcePanel) highlight(lines map[int]bool) {
+	base := m.base()
+	base.Lock()
+	defer base.Unlock()
+	if !m.styled {
+		// first check: remember the colors the widget was set up with
+		m.styled = true
+		m.border = base.BorderStyle
+		switch {
+		case m.plot != nil:
+			m.lineColors = m.plot.LineColors
+		case m.gauge != nil:
+			m.barColor = m.gauge.BarColor
+		}
+	}
+	base.BorderStyle = m.border
+	if len(lines) > 0 {
+		base.BorderStyle = styling.NewStyle(alertColor, m.border.Bg, styling.ModifierBold)
+	}
+	if m.gauge != nil {
+		m.gauge.BarColor = m.barColor
+		if lines[0] {
+			m.gauge.BarColor = alertColor
+		}
+		return
+	}
+	if m.sparklines != nil {
+		for i, sparkline := range m.sparklines.Sparklines {
+			sparkline.LineColor = m.sparkColor
+			if lines[i] {
+				sparkline.LineColor = alertColor
+			}
+		}
+		return
+	}
+	if len(lines) == 0 {
+		m.plot.LineColors = m.lineColors
+		return
+	}
+	colors := make([]styling.Color, len(m.series))
+	for i := range colors {
+		colors[i] = colorAt(m.lineColors, i)
+		switch {
+		case lines[i]:
+			colors[i] = alertColor
+		case colors[i] == alertColor:
+			colors[i] = styling.ColorWhite // keep a quiet line from looking like a firing one
+		}
+	}
+	m.plot.LineColors = colors
+}
+
+// colorAt is the i-th color of a palette that repeats
+func colorAt(colors []styling.Color, i int) styling.Color {
+	if len(colors) == 0 {
+		return styling.ColorWhite
+	}
+	return colors[i%len(colors)]
+}
+
+// alertBanner is the line under the widgets naming the firing rules; blank while none fire
+type alertBanner struct {
+	draw.Base
+	text string
+}
+
+// set changes the banner text
+func (b *alertBanner) set(text string) {
+	b.Lock()
+	defer b.Unlock()
+	b.text = text
+}
+
+func (b *alertBanner) Draw(buf *draw.Buffer) {
+	if b.text == "" {
+		buf.Fill(draw.CellClear, b.Rectangle)
+		return
+	}
+	style := styling.NewStyle(styling.ColorWhite, alertColor, styling.ModifierBold)
+	buf.Fill(draw.Cell{Rune: ' ', Style: style}, b.Rectangle)
+	text := []rune(b.text)
+	if len(text) > b.Dx() {
+		text = append(text[:max(b.Dx()-1, 0)], '…')
+	}
+	buf.SetString(string(text), style, image.Pt(b.Min.X, b.Min.Y))
+}
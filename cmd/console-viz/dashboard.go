@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"console-viz/collector"
+	"console-viz/dashboard"
+	"console-viz/draw"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// buildDashboard creates the widgets and layout described by a --config spec, plus a panel for
+// every widget fed by a live source (metrics) and a schedule for file sources with a refresh interval
+func buildDashboard(spec *dashboard.Spec, base Config) (*draw.Layout, []draw.Drawable, []*sourcePanel, []*schedule, error) {
+	var widgetList []draw.Drawable
+	var panels []*sourcePanel
+	var schedules []*schedule
+	var stdinData []byte // stdin can only be read once; widgets sharing it reuse the bytes
+
+	layout, err := dashboard.Build(spec.Layout, func(w *dashboard.Widget) (draw.Drawable, error) {
+		src, err := spec.Source(w.Source)
+		if err != nil {
+			return nil, err
+		}
+		colors, err := dashboard.ParseColors(w.Colors)
+		if err != nil {
+			return nil, fmt.Errorf("widget %q: %w", w.Title, err)
+		}
+		widgetType := strings.ToLower(strings.TrimSpace(w.Type))
+
+		if src.Live() {
+			interval := time.Duration(src.Refresh)
+			if interval <= 0 {
+				interval = base.Interval
+			}
+			history := string(src.History)
+			if history == "" {
+				history = base.History
+			}
+			capacity, err := parseHistory(history, interval)
+			if err != nil {
+				return nil, fmt.Errorf("widget %q: %w", w.Title, err)
+			}
+			kind, cfg, err := liveSource(base, src, interval)
+			if err != nil {
+				return nil, fmt.Errorf("widget %q: %w", w.Title, err)
+			}
+			panel, err := newLivePanel(kind, cfg, widgetType, w.Title, capacity)
+			if err != nil {
+				return nil, fmt.Errorf("widget %q: %w", w.Title, err)
+			}
+			applyColors(panel.widget(), colors)
+			if panel.sparklines != nil && len(colors) > 0 {
+				panel.sparkColor = colors[0] // sparklines are added as series appear
+			}
+			panels = append(panels, panel)
+			widgetList = append(widgetList, panel.widget())
+			return panel.widget(), nil
+		}
+
+		if widgetType == "" {
+			widgetType = "table"
+		}
+		config := widgetConfig(base, src, w)
+		var data interface{}
+		if src.File == "-" {
+			if stdinData == nil {
+				if stdinData, err = io.ReadAll(os.Stdin); err != nil {
+					return nil, fmt.Errorf("read stdin: %w", err)
+				}
+			}
+			data, err = loadInput(bytes.NewReader(stdinData), config)
+		} else {
+			data, err = loadFileData(config)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", src.File, err)
+		}
+		widget, err := createWidget(widgetType, data, config)
+		if err != nil {
+			return nil, fmt.Errorf("widget %s: %w", widgetType, err)
+		}
+		applyColors(widget, colors)
+		// stdin is read once, so only real files are reloaded
+		if interval := time.Duration(src.Refresh); interval > 0 && src.File != "-" {
+			panel := &filePanel{current: widget, widgetType: widgetType, config: config, colors: colors}
+			schedules = append(schedules, &schedule{panel: panel, interval: interval, next: time.Now().Add(interval)})
+		}
+		widgetList = append(widgetList, widget)
+		return widget, nil
+	})
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return layout, widgetList, panels, schedules, nil
+}
+
+// liveSource returns the collector source kind and options for a metrics, exec, system, StatsD or
+// PromQL source; scrape settings the source doesn't set come from the command line (and environment)
+func liveSource(base Config, src *dashboard.Source, interval time.Duration) (string, collector.SourceConfig, error) {
+	if src.StatsD != "" {
+		return "statsd", collector.SourceConfig{URL: src.StatsD, Exprs: src.Metrics, Interval: interval}, nil
+	}
+	if src.System != "" {
+		return "system", collector.SourceConfig{Exprs: []string{src.System}, Root: src.Root, Interval: interval}, nil
+	}
+	if src.Exec != "" {
+		return "exec", collector.SourceConfig{Command: src.Exec, Pattern: src.Pattern, Interval: interval, Timeout: time.Duration(src.Timeout)}, nil
+	}
+	if src.BearerToken != "" || src.BearerTokenFile != "" || src.BasicAuth != "" {
+		// the source's own credentials replace the command line's
+		base.BearerToken, base.BearerTokenFile, base.BasicAuth = src.BearerToken, src.BearerTokenFile, src.BasicAuth
+	}
+	if src.CAFile != "" {
+		base.CAFile = src.CAFile
+	}
+	if src.CertFile != "" {
+		base.CertFile, base.KeyFile = src.CertFile, src.KeyFile
+	}
+	base.InsecureSkipVerify = base.InsecureSkipVerify || src.InsecureSkipVerify
+	if src.Timeout > 0 {
+		base.ScrapeTimeout = time.Duration(src.Timeout)
+	}
+	httpCfg, err := scrapeConfig(base)
+	if err != nil {
+		return "", collector.SourceConfig{}, err
+	}
+	if src.PrometheusURL != "" {
+		return "promql", collector.SourceConfig{URL: src.PrometheusURL, Exprs: src.Queries, Interval: interval, HTTP: httpCfg}, nil
+	}
+	targets := []string(src.Targets)
+	if src.TargetsFile != "" {
+		more, err := collector.LoadTargets(src.TargetsFile)
+		if err != nil {
+			return "", collector.SourceConfig{}, err
+		}
+		targets = append(targets, more...)
+	}
+	return "prometheus", collector.SourceConfig{URL: src.MetricsURL, Targets: targets, Exprs: src.Metrics, Interval: interval, HTTP: httpCfg}, nil
+}
+
+// widgetConfig merges a source's options with a widget's own (widget options win) into the
+// Config the loaders and createWidget take
+func widgetConfig(base Config, src *dashboard.Source, w *dashboard.Widget) Config {
+	config := Config{
+		DataFile:       src.File,
+		Format:         src.Format,
+		Delimiter:      src.Delimiter,
+		Comment:        src.Comment,
+		LazyQuotes:     src.LazyQuotes,
+		VariableFields: src.VariableFields,
+		SkipRows:       src.SkipRows,
+		Limit:          src.Limit,
+		Rows:           src.Rows,
+		Columns:        src.Columns.String(),
+		JSONPath:       src.JSONPath,
+		JSONLabelPath:  src.JSONLabelPath,
+		GroupBy:        src.GroupBy.String(),
+		Agg:            src.Agg,
+		Theme:          base.Theme,
+		Title:          w.Title,
+		XAxis:          w.XAxis,
+		YAxis:          w.YAxis.String(),
+	}
+	if len(w.Columns) > 0 {
+		config.Columns = w.Columns.String()
+	}
+	if w.Rows != "" {
+		config.Rows = w.Rows
+	}
+	if w.Limit > 0 {
+		config.Limit = w.Limit
+	}
+	if len(w.GroupBy) > 0 {
+		config.GroupBy = w.GroupBy.String()
+	}
+	if w.Agg != "" {
+		config.Agg = w.Agg
+	}
+	if config.Delimiter == "" {
+		config.Delimiter = "auto"
+	}
+	return config
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"console-viz/collector"
+	"console-viz/dashboard"
+	"console-viz/dataset"
 	"console-viz/draw"
+	"console-viz/jsonpath"
 	"console-viz/styling"
 	"console-viz/widgets"
 	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -20,20 +26,81 @@ import (
 
 // Config holds CLI configuration
 type Config struct {
-	DataFile   string
-	MetricsURL string   // when set, use metrics mode
-	Metrics    []string // metric selectors for generic graphing (e.g. go_gc_duration_seconds{quantile="0"}); repeatable
-	Layout     string
-	Columns    string
-	Rows       string
-	SkipRows   int
-	Limit      int
-	Theme      string
-	XAxis      string
-	YAxis      string
-	Title      string
-	Format     string
-	ConfigFile string
+	DataFile    string
+	MetricsURLs []string // scrape targets (--metrics-url, repeatable, plus --targets); when set, use metrics mode
+	Metrics     []string // metric selectors for generic graphing (e.g. go_gc_duration_seconds{quantile="0"}); repeatable
+	Layout      string
+	Columns     string
+	Rows        string
+	SkipRows    int
+	Limit       int
+	Theme       string
+	XAxis       string
+	YAxis       string
+	Title       string
+	Format      string
+	ConfigFile  string
+
+	// CSV reader options (also used for .tsv/.psv)
+	Delimiter      string // field separator: ",", "tab", "|", ";" or "auto" (sniff from the first lines)
+	Comment        string // lines starting with this character are skipped (e.g. "#")
+	LazyQuotes     bool   // tolerate stray quotes inside unquoted fields
+	VariableFields bool   // allow rows with a different number of fields than the header
+
+	// JSON field selection (JSONPath-style, e.g. $.categories[*].value)
+	JSONPath      string // selects the values to chart
+	JSONLabelPath string // selects the matching labels (optional)
+
+	// Aggregation on tabular input
+	GroupBy string // key column(s), comma-separated
+	Agg     string // sum, avg, min, max, count, median, p95 (any pNN)
+
+	// Live metrics
+	Interval time.Duration // scrape interval (also the default refresh for --config metrics sources)
+	History  string        // scrapes kept per line: a count ("120") or a duration ("1h")
+
+	// Scraping (--metrics-url); several targets overlay in one plot unless SplitTargets
+	TargetsFile  string // file listing more targets (one per line, or Prometheus file_sd JSON)
+	SplitTargets bool   // one widget per target, laid out in a grid
+	Record       string // append every raw scrape to this file
+	Replay       string // play a --record file back instead of scraping; when set, use replay mode
+	Speed        string // replay speed: "10x", "0.5x" or "max"
+
+	// Linux system metrics (--system), read from /proc and /sys
+	System     bool
+	SystemRoot string // directory holding proc and sys, "/" for this machine
+
+	// StatsD over UDP (--listen-statsd), aggregated every --interval
+	ListenStatsD string // address to listen on, e.g. ":8125"
+
+	// PromQL over a Prometheus-compatible API (--prometheus-url), backfilled to --history
+	PrometheusURL string   // server address, e.g. localhost:9090 (its /api/v1/query_range is queried)
+	Queries       []string // PromQL expressions, one group of lines each
+
+	// Threshold alerts on live lines, e.g. "windows_cpu_core_frequency_mhz < 1000 for 2m"
+	Alerts       []string
+	AlertBell    bool   // ring the terminal bell when a rule starts firing
+	AlertCommand string // shell hook run when a rule starts or stops firing
+
+	// credentials also come from the environment (see scrapeConfig)
+	ScrapeTimeout      time.Duration // per scrape; 0 uses --interval, at most 10s
+	BearerToken        string
+	BearerTokenFile    string
+	BasicAuth          string // user:password
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	// Command output (--exec)
+	Exec        string        // shell command run every Interval; when set, use exec mode
+	ExecPattern string        // regex pulling fields out of the output
+	ExecTimeout time.Duration // per run; 0 uses Interval
+}
+
+// live reports whether the command line asks for a live source (metrics, exec, a replay, system, statsd or PromQL) instead of a data file
+func (c Config) live() bool {
+	return len(c.MetricsURLs) > 0 || c.Exec != "" || c.Replay != "" || c.System || c.ListenStatsD != "" || c.PrometheusURL != ""
 }
 
 // parseLayout parses layout string like "80:20" or "barchart:80,plot:20"
@@ -152,6 +219,75 @@ func (s *stringSlice) Set(v string) error {
 	return nil
 }
 
+// snapshotFlag is the --snapshot[=WxH] flag: a bare --snapshot uses the default size
+type snapshotFlag struct {
+	enabled       bool
+	width, height int
+}
+
+// defaultSnapshotWidth and defaultSnapshotHeight are used when neither WxH nor $COLUMNS/$LINES is set
+const (
+	defaultSnapshotWidth  = 100
+	defaultSnapshotHeight = 30
+)
+
+func (s *snapshotFlag) String() string {
+	if !s.enabled {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", s.width, s.height)
+}
+
+// IsBoolFlag lets --snapshot be given without a value
+func (s *snapshotFlag) IsBoolFlag() bool { return true }
+
+func (s *snapshotFlag) Set(v string) error {
+	switch strings.ToLower(v) {
+	case "false":
+		s.enabled = false
+		return nil
+	case "true":
+		s.enabled = true
+		s.width = envInt("COLUMNS", defaultSnapshotWidth)
+		s.height = envInt("LINES", defaultSnapshotHeight)
+		return nil
+	}
+	parts := strings.Split(strings.ToLower(v), "x")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid size %q (want WxH, e.g. 120x40)", v)
+	}
+	w, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	h, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return fmt.Errorf("invalid size %q (want WxH, e.g. 120x40)", v)
+	}
+	s.enabled, s.width, s.height = true, w, h
+	return nil
+}
+
+// envInt reads a positive integer from the environment, or returns def
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// useColor resolves --color: "always", "never", or "auto" (ANSI only when stdout is a terminal and NO_COLOR is unset)
+func useColor(mode string) bool {
+	switch strings.ToLower(mode) {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 // parseColumnSpec parses column specification like "1-3" or "name,value" or "1,3,5"
 func parseColumnSpec(spec string, headers []string) ([]int, error) {
 	if spec == "" {
@@ -257,15 +393,144 @@ func parseRowSpec(spec string, totalRows int) (start, end int, err error) {
 	return val - 1, val, nil
 }
 
-// loadCSV loads a CSV file
-func loadCSV(filePath string, config Config) ([][]string, error) {
-	file, err := os.Open(filePath)
+// sniffBufferSize is how many bytes we peek at when guessing a format or delimiter
+const sniffBufferSize = 64 * 1024
+
+// sniffLines is how many lines of a delimited file we look at to guess the delimiter
+const sniffLines = 5
+
+// candidateDelimiters are the separators we try when sniffing, in order of preference on ties
+var candidateDelimiters = []rune{',', '\t', '|', ';'}
+
+// defaultDelimiter returns the delimiter implied by a format name (tsv => tab, psv => pipe), or 0 to sniff
+func defaultDelimiter(format string) rune {
+	switch format {
+	case "tsv":
+		return '\t'
+	case "psv":
+		return '|'
+	}
+	return 0
+}
+
+// parseDelimiter turns the --delimiter value into a rune; returns 0 for "" or "auto" (sniff)
+func parseDelimiter(spec string) (rune, error) {
+	switch strings.ToLower(spec) {
+	case "", "auto":
+		return 0, nil
+	case "tab", "\\t", "\t":
+		return '\t', nil
+	case "pipe":
+		return '|', nil
+	case "comma":
+		return ',', nil
+	case "semicolon":
+		return ';', nil
+	case "space":
+		return ' ', nil
+	}
+	runes := []rune(spec)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' {
+		return 0, fmt.Errorf("invalid delimiter: %q", spec)
+	}
+	return runes[0], nil
+}
+
+// sniffDelimiter guesses the field separator from the first few lines of a file.
+// A good candidate appears the same (non-zero) number of times on every line; ties go to the
+// candidate seen most often. Falls back to comma when nothing looks consistent.
+func sniffDelimiter(sample []byte, comment rune) rune {
+	lines := []string{}
+	for _, line := range strings.Split(string(sample), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if comment != 0 && strings.HasPrefix(line, string(comment)) {
+			continue
+		}
+		lines = append(lines, line)
+		if len(lines) == sniffLines {
+			break
+		}
+	}
+	// the last line of the sample may be cut off mid-row, so drop it when we have enough
+	if len(lines) > 2 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ','
+	}
+
+	best := rune(0)
+	bestCount := 0
+	for _, delim := range candidateDelimiters {
+		count := countOutsideQuotes(lines[0], delim)
+		if count == 0 {
+			continue
+		}
+		consistent := true
+		for _, line := range lines[1:] {
+			if countOutsideQuotes(line, delim) != count {
+				consistent = false
+				break
+			}
+		}
+		if consistent && count > bestCount {
+			best = delim
+			bestCount = count
+		}
+	}
+	if best == 0 {
+		return ','
+	}
+	return best
+}
+
+// countOutsideQuotes counts occurrences of delim in line, ignoring any inside double-quoted fields
+func countOutsideQuotes(line string, delim rune) int {
+	count := 0
+	inQuotes := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == delim && !inQuotes:
+			count++
+		}
+	}
+	return count
+}
+
+// loadCSV loads delimited data (CSV, TSV, PSV); the delimiter comes from --delimiter,
+// the format (tsv/psv), or is sniffed from the first lines of the input
+func loadCSV(r io.Reader, config Config) ([][]string, error) {
+	delim, err := parseDelimiter(config.Delimiter)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	if delim == 0 {
+		delim = defaultDelimiter(config.Format)
+	}
+	var comment rune
+	if config.Comment != "" {
+		comment = []rune(config.Comment)[0]
+	}
+
+	// peek at the start of the input without consuming it so the csv reader still sees every row
+	buffered := bufio.NewReaderSize(r, sniffBufferSize)
+	if delim == 0 {
+		sample, _ := buffered.Peek(sniffBufferSize)
+		delim = sniffDelimiter(sample, comment)
+	}
 
-	reader := csv.NewReader(file)
+	reader := csv.NewReader(buffered)
+	reader.Comma = delim
+	reader.Comment = comment
+	reader.LazyQuotes = config.LazyQuotes
+	if config.VariableFields {
+		reader.FieldsPerRecord = -1 // don't require every row to match the header's field count
+	}
 	records, err := reader.ReadAll()
 	if err != nil {
 		return nil, err
@@ -298,43 +563,461 @@ func loadCSV(filePath string, config Config) ([][]string, error) {
 	}
 
 	// Apply column filter
-	if config.Columns != "" && len(records) > 0 {
-		headers := records[0]
-		colIndices, err := parseColumnSpec(config.Columns, headers)
+	return selectColumns(records, config.Columns)
+}
+
+// selectColumns keeps only the columns named by spec (see parseColumnSpec); the first row is the header
+func selectColumns(records [][]string, spec string) ([][]string, error) {
+	if spec == "" || len(records) == 0 {
+		return records, nil
+	}
+	headers := records[0]
+	colIndices, err := parseColumnSpec(spec, headers)
+	if err != nil {
+		return nil, err
+	}
+	if len(colIndices) == 0 {
+		return records, nil
+	}
+	filtered := [][]string{}
+	for _, record := range records {
+		filteredRow := []string{}
+		for _, idx := range colIndices {
+			if idx < len(record) {
+				filteredRow = append(filteredRow, record[idx])
+			}
+		}
+		filtered = append(filtered, filteredRow)
+	}
+	return filtered, nil
+}
+
+// loadJSON loads a single JSON document
+func loadJSON(r io.Reader) (interface{}, error) {
+	var jsonData interface{}
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&jsonData); err != nil {
+		return nil, err
+	}
+	// the document must be all there is: trailing garbage or a second document is an error
+	var extra interface{}
+	if err := dec.Decode(&extra); err != io.EOF {
+		if err == nil {
+			return nil, fmt.Errorf("more than one JSON document (use --format ndjson for one per line)")
+		}
+		return nil, fmt.Errorf("after the JSON document: %w", err)
+	}
+
+	return jsonData, nil
+}
+
+// ndjsonRecord is one NDJSON line decoded as an object, keeping its keys in document order
+// so the table header follows the order fields first appear in the file
+type ndjsonRecord struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// UnmarshalJSON decodes an object key by key; a non-object line (e.g. a bare number)
+// becomes a record with a single "value" field
+func (rec *ndjsonRecord) UnmarshalJSON(data []byte) error {
+	rec.keys = nil
+	rec.values = map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		rec.keys = []string{"value"}
+		rec.values["value"] = value
+		return nil
+	}
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := keyTok.(string)
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		if _, seen := rec.values[key]; !seen {
+			rec.keys = append(rec.keys, key)
+		}
+		rec.values[key] = value
+	}
+	return nil
+}
+
+// formatJSONValue renders one JSON value as a table cell: numbers without exponent noise,
+// missing/null as empty, nested objects and arrays as compact JSON
+func formatJSONValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		encoded, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%v", val)
+		}
+		return string(encoded)
+	}
+}
+
+// loadNDJSON streams newline-delimited JSON (JSON Lines) into a table: the header is the union of
+// all keys in first-seen order, and each record becomes one row. Records are decoded one at a time,
+// so the file never has to fit in memory as a single document; --skip-rows and --limit count records
+// and stop reading early.
+func loadNDJSON(r io.Reader, config Config) ([][]string, error) {
+	header := []string{}
+	columnIndex := map[string]int{}
+	rows := [][]string{}
+
+	dec := json.NewDecoder(r)
+	recordNum := 0
+	for {
+		var rec ndjsonRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", recordNum+1, err)
+		}
+		recordNum++
+		if recordNum <= config.SkipRows {
+			continue
+		}
+
+		// grow the header with any keys we haven't seen before
+		for _, key := range rec.keys {
+			if _, ok := columnIndex[key]; !ok {
+				columnIndex[key] = len(header)
+				header = append(header, key)
+			}
+		}
+		row := make([]string, len(header))
+		for key, value := range rec.values {
+			row[columnIndex[key]] = formatJSONValue(value)
+		}
+		rows = append(rows, row)
+
+		if config.Limit > 0 && len(rows) >= config.Limit {
+			break
+		}
+	}
+
+	// rows read before a key first appeared are shorter than the final header; pad them
+	for i := range rows {
+		for len(rows[i]) < len(header) {
+			rows[i] = append(rows[i], "")
+		}
+	}
+
+	// Apply row filter (on records, not counting the synthesized header)
+	if config.Rows != "" {
+		rowStart, rowEnd, err := parseRowSpec(config.Rows, len(rows))
 		if err != nil {
 			return nil, err
 		}
-		if len(colIndices) > 0 {
-			filtered := [][]string{}
-			for _, record := range records {
-				filteredRow := []string{}
-				for _, idx := range colIndices {
-					if idx < len(record) {
-						filteredRow = append(filteredRow, record[idx])
-					}
-				}
-				filtered = append(filtered, filteredRow)
+		if rowStart < len(rows) {
+			if rowEnd > len(rows) {
+				rowEnd = len(rows)
 			}
-			records = filtered
+			rows = rows[rowStart:rowEnd]
 		}
 	}
 
-	return records, nil
+	table := append([][]string{header}, rows...)
+	return selectColumns(table, config.Columns)
+}
+
+// loadNDJSONValues decodes newline-delimited JSON into an array of values (used when a
+// --json-path needs to see the raw records rather than the flattened table)
+func loadNDJSONValues(r io.Reader) ([]interface{}, error) {
+	values := []interface{}{}
+	dec := json.NewDecoder(r)
+	for {
+		var value interface{}
+		err := dec.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", len(values)+1, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
 }
 
-// loadJSON loads a JSON file
-func loadJSON(filePath string) (interface{}, error) {
-	data, err := ioutil.ReadFile(filePath)
+// applyJSONPath picks values (and optionally labels) out of a JSON document with --json-path and
+// --json-label-path. Scalar results become a label/value table, so every widget reads them like CSV
+// columns 0 and 1; non-scalar results (e.g. $.categories[*]) are returned as a JSON array for the
+// usual table and numeric extraction.
+func applyJSONPath(jsonData interface{}, config Config) (interface{}, error) {
+	valuePath, err := jsonpath.Compile(config.JSONPath)
 	if err != nil {
 		return nil, err
 	}
+	values := valuePath.Find(jsonData)
+	if len(values) == 0 {
+		return nil, fmt.Errorf("--json-path %s matched nothing", config.JSONPath)
+	}
+	// a path to a whole array (e.g. $.time_series) means its elements
+	if arr, ok := values[0].([]interface{}); ok && len(values) == 1 {
+		values = arr
+	}
 
-	var jsonData interface{}
-	if err := json.Unmarshal(data, &jsonData); err != nil {
+	var labels []interface{}
+	labelHeader := "label"
+	if config.JSONLabelPath != "" {
+		labelPath, err := jsonpath.Compile(config.JSONLabelPath)
+		if err != nil {
+			return nil, err
+		}
+		labels = labelPath.Find(jsonData)
+		if len(labels) != len(values) {
+			return nil, fmt.Errorf("--json-label-path matched %d labels for %d values", len(labels), len(values))
+		}
+		if field := labelPath.LastField(); field != "" {
+			labelHeader = field
+		}
+	}
+
+	for _, v := range values {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			// structured results: let the widgets treat them like any other JSON array
+			if len(values) == 1 {
+				return v, nil
+			}
+			return values, nil
+		}
+	}
+
+	valueHeader := valuePath.LastField()
+	if valueHeader == "" {
+		valueHeader = "value"
+	}
+	rows := [][]string{{labelHeader, valueHeader}}
+	for i, v := range values {
+		label := fmt.Sprintf("Item %d", i+1)
+		if labels != nil {
+			label = formatJSONValue(labels[i])
+		}
+		rows = append(rows, []string{label, formatJSONValue(v)})
+	}
+	return rows, nil
+}
+
+// loadNumbers loads plain numbers (whitespace- or comma-separated, any number per line)
+// into an array so the chart widgets can use them like a JSON array of numbers
+func loadNumbers(r io.Reader) (interface{}, error) {
+	values := []interface{}{}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, field := range splitNumberFields(line) {
+			val, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: not a number: %s", lineNum, field)
+			}
+			values = append(values, val)
+		}
+	}
+	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
+	return values, nil
+}
 
-	return jsonData, nil
+// splitNumberFields splits a line of plain numbers on whitespace and commas
+func splitNumberFields(line string) []string {
+	return strings.FieldsFunc(line, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// sniffFormat guesses the data format (csv, json, ndjson, txt) from the start of the input.
+// Used when reading stdin or a file without a recognised extension.
+func sniffFormat(sample []byte) string {
+	text := strings.TrimSpace(string(sample))
+	if text == "" {
+		return "csv"
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") {
+		// several lines that each hold a complete JSON value (objects, arrays, ...) => NDJSON;
+		// otherwise one document
+		if len(lines) < 2 {
+			return "json"
+		}
+		for i, line := range lines {
+			// the sample may end mid-line, so don't judge the last line of a full buffer
+			if i == len(lines)-1 && len(sample) == sniffBufferSize {
+				break
+			}
+			if !json.Valid([]byte(line)) {
+				return "json"
+			}
+		}
+		return "ndjson"
+	}
+
+	// plain numbers: every line is made of numeric fields only
+	allNumeric := true
+	for i, line := range lines {
+		// the sample may end mid-line, so don't judge the last line of a full buffer
+		if i == len(lines)-1 && len(sample) == sniffBufferSize {
+			break
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, field := range splitNumberFields(line) {
+			if _, err := strconv.ParseFloat(field, 64); err != nil {
+				allNumeric = false
+				break
+			}
+		}
+		if !allNumeric {
+			break
+		}
+	}
+	if allNumeric {
+		return "txt"
+	}
+	return "csv"
+}
+
+// stdinIsPiped reports whether stdin is a pipe or file rather than an interactive terminal
+func stdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// openInput opens the data source: "-" means stdin, anything else is a file path
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// loadData reads r according to config.Format and returns either [][]string (tabular) or decoded JSON
+func loadData(r io.Reader, config Config) (interface{}, error) {
+	if config.JSONPath != "" {
+		var jsonData interface{}
+		var err error
+		switch config.Format {
+		case "json":
+			jsonData, err = loadJSON(r)
+		case "ndjson", "jsonl":
+			jsonData, err = loadNDJSONValues(r)
+		default:
+			return nil, fmt.Errorf("--json-path needs JSON or NDJSON input, got %s", config.Format)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return applyJSONPath(jsonData, config)
+	}
+
+	switch config.Format {
+	case "csv", "tsv", "psv":
+		return loadCSV(r, config)
+	case "json":
+		return loadJSON(r)
+	case "ndjson", "jsonl":
+		return loadNDJSON(r, config)
+	case "txt":
+		return loadNumbers(r)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", config.Format)
+	}
+}
+
+// loadFileData opens config.DataFile and loads it with loadInput.
+// The format comes from --format, then the file extension; stdin and extension-less files are sniffed.
+func loadFileData(config Config) (interface{}, error) {
+	ext := strings.ToLower(filepath.Ext(config.DataFile))
+	if config.Format == "" && ext != "" && config.DataFile != "-" {
+		config.Format = ext[1:] // Remove dot
+	}
+
+	input, err := openInput(config.DataFile)
+	if err != nil {
+		return nil, fmt.Errorf("open input: %w", err)
+	}
+	defer input.Close()
+	return loadInput(input, config)
+}
+
+// loadInput loads r (sniffing the format when config.Format is empty). Tabular data is returned as a
+// typed *dataset.Dataset (grouped when --group-by is set); anything else is decoded JSON.
+func loadInput(r io.Reader, config Config) (interface{}, error) {
+	if config.Agg != "" && config.GroupBy == "" {
+		return nil, fmt.Errorf("--agg %s needs --group-by", config.Agg)
+	}
+	reader := bufio.NewReaderSize(r, sniffBufferSize)
+	if config.Format == "" {
+		sample, _ := reader.Peek(sniffBufferSize)
+		config.Format = sniffFormat(sample)
+	}
+
+	data, err := loadData(reader, config)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", strings.ToUpper(config.Format), err)
+	}
+
+	// Tabular data: infer column types once so every widget reads the same typed values
+	rows, ok := data.([][]string)
+	if !ok {
+		return data, nil
+	}
+	ds := dataset.FromRows(rows)
+	for _, msg := range ds.ParseErrors() {
+		log.Printf("Warning: %s", msg)
+	}
+	if config.GroupBy != "" {
+		ds, err = groupDataset(ds, config)
+		if err != nil {
+			return nil, fmt.Errorf("group data: %w", err)
+		}
+	}
+	if len(os.Getenv("DEBUG")) > 0 {
+		log.Printf("DEBUG: schema: %v", ds.Schema())
+	}
+	return ds, nil
 }
 
 // numericFieldNames are JSON keys we try when extracting numbers from array-of-objects
@@ -452,13 +1135,145 @@ func jsonToTable(jsonData interface{}) [][]string {
 	return rows
 }
 
-// createWidget creates a widget based on type and data
+// chartColumns picks the label (x) and value (y) columns for chart widgets from the typed schema.
+// --x and --y (names or 1-based indices; --y may list several, comma-separated) win when set;
+// otherwise labels come from the first categorical or timestamp column and values from the first
+// numeric column. label is nil when there's no label column (rows are then labelled by position).
+func chartColumns(ds *dataset.Dataset, config Config) (label *dataset.Column, values []*dataset.Column, err error) {
+	if config.XAxis != "" {
+		label, err = ds.Column(config.XAxis)
+		if err != nil {
+			return nil, nil, fmt.Errorf("--x: %w", err)
+		}
+	} else if ds.KeyColumns > 0 {
+		label = ds.KeyLabel() // grouped data: the group keys are the labels
+	} else {
+		label = ds.LabelColumn()
+	}
+
+	if config.YAxis != "" {
+		for _, spec := range strings.Split(config.YAxis, ",") {
+			col, err := ds.Column(spec)
+			if err != nil {
+				return nil, nil, fmt.Errorf("--y: %w", err)
+			}
+			if !col.Type.IsNumeric() {
+				return nil, nil, fmt.Errorf("--y: column %q is %s, not numeric", col.Name, col.Type)
+			}
+			values = append(values, col)
+		}
+		return label, values, nil
+	}
+
+	for _, col := range ds.NumericColumns() {
+		if col != label {
+			values = append(values, col)
+			break
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil, fmt.Errorf("no numeric column found (columns: %s)", strings.Join(ds.Schema(), ", "))
+	}
+	return label, values, nil
+}
+
+// groupDataset applies --group-by/--agg: rows are grouped by the key columns and the --y columns
+// (default: every numeric column that isn't a key) are reduced with the aggregation
+func groupDataset(ds *dataset.Dataset, config Config) (*dataset.Dataset, error) {
+	aggName := config.Agg
+	if aggName == "" {
+		aggName = "sum"
+	}
+	agg, err := dataset.ParseAggregation(aggName)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []*dataset.Column{}
+	isKey := map[*dataset.Column]bool{}
+	for _, spec := range strings.Split(config.GroupBy, ",") {
+		col, err := ds.Column(spec)
+		if err != nil {
+			return nil, fmt.Errorf("--group-by: %w", err)
+		}
+		keys = append(keys, col)
+		isKey[col] = true
+	}
+
+	values := []*dataset.Column{}
+	if agg.Name != "count" {
+		if config.YAxis != "" {
+			for _, spec := range strings.Split(config.YAxis, ",") {
+				col, err := ds.Column(spec)
+				if err != nil {
+					return nil, fmt.Errorf("--y: %w", err)
+				}
+				if !col.Type.IsNumeric() {
+					return nil, fmt.Errorf("--y: column %q is %s, not numeric (--agg %s needs numbers)", col.Name, col.Type, agg.Name)
+				}
+				values = append(values, col)
+			}
+		} else {
+			for _, col := range ds.NumericColumns() {
+				if !isKey[col] {
+					values = append(values, col)
+				}
+			}
+		}
+	}
+	return ds.GroupBy(keys, values, agg), nil
+}
+
+// columnSeries returns labels and one value slice per value column, keeping only rows where every
+// value column parsed. Skipping whole rows keeps labels and all series aligned.
+func columnSeries(label *dataset.Column, valueCols []*dataset.Column) ([]string, [][]float64) {
+	labels := []string{}
+	series := make([][]float64, len(valueCols))
+	if len(valueCols) == 0 {
+		return labels, series
+	}
+	for i := range valueCols[0].Values {
+		valid := true
+		for _, col := range valueCols {
+			if !col.Valid(i) {
+				valid = false
+				break
+			}
+		}
+		if !valid {
+			continue
+		}
+		if label != nil {
+			labels = append(labels, label.Cells[i])
+		} else {
+			labels = append(labels, fmt.Sprintf("Item %d", i+1))
+		}
+		for j, col := range valueCols {
+			series[j] = append(series[j], col.Values[i])
+		}
+	}
+	return labels, series
+}
+
+// columnNames returns the header of each column (used as plot legends and sparkline titles)
+func columnNames(cols []*dataset.Column) []string {
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// createWidget creates a widget based on type and data.
+// Tabular data arrives as a *dataset.Dataset; anything else is decoded JSON.
 func createWidget(widgetType string, data interface{}, config Config) (draw.Drawable, error) {
+	ds, tabular := data.(*dataset.Dataset)
+
 	switch widgetType {
 	case "table":
 		var tableRows [][]string
-		if csvData, ok := data.([][]string); ok {
-			tableRows = csvData
+		if tabular {
+			tableRows = append([][]string{ds.Headers}, ds.Rows...)
 		} else {
 			// Try to convert JSON to table
 			tableRows = jsonToTable(data)
@@ -476,22 +1291,16 @@ func createWidget(widgetType string, data interface{}, config Config) (draw.Draw
 	case "barchart":
 		var values []float64
 		var labels []string
-		
-		if csvData, ok := data.([][]string); ok && len(csvData) > 1 {
-			// CSV data
-			for i, row := range csvData {
-				if i == 0 {
-					continue // Skip header
-				}
-				if len(row) > 0 {
-					labels = append(labels, row[0])
-				}
-				if len(row) > 1 {
-					if val, err := strconv.ParseFloat(row[1], 64); err == nil {
-						values = append(values, val)
-					}
-				}
+
+		if tabular {
+			labelCol, valueCols, err := chartColumns(ds, config)
+			if err != nil {
+				return nil, fmt.Errorf("barchart widget: %w", err)
 			}
+			// one value per bar: only the first --y column is used
+			var series [][]float64
+			labels, series = columnSeries(labelCol, valueCols[:1])
+			values = series[0]
 		} else {
 			// JSON data
 			values = extractNumericArray(data)
@@ -503,11 +1312,11 @@ func createWidget(widgetType string, data interface{}, config Config) (draw.Draw
 				labels = append(labels, fmt.Sprintf("Item %d", i+1))
 			}
 		}
-		
+
 		if len(values) == 0 {
 			return nil, fmt.Errorf("barchart widget: no numeric data found")
 		}
-		
+
 		chart := widgets.NewBarChart()
 		chart.Data = values
 		chart.Labels = labels
@@ -517,91 +1326,96 @@ func createWidget(widgetType string, data interface{}, config Config) (draw.Draw
 		return chart, nil
 
 	case "plot":
-		var values []float64
-		
-		if csvData, ok := data.([][]string); ok && len(csvData) > 1 {
-			// CSV data
-			for i, row := range csvData {
-				if i == 0 {
-					continue // Skip header
-				}
-				if len(row) > 1 {
-					if val, err := strconv.ParseFloat(row[1], 64); err == nil {
-						values = append(values, val)
-					}
-				}
+		var series [][]float64
+		var seriesLabels []string
+		var xLabels []string
+
+		if tabular {
+			// one line per --y column; legend from the headers, x-axis labels from the --x column
+			labelCol, valueCols, err := chartColumns(ds, config)
+			if err != nil {
+				return nil, fmt.Errorf("plot widget: %w", err)
+			}
+			xLabels, series = columnSeries(labelCol, valueCols)
+			if labelCol == nil {
+				xLabels = nil // keep the numeric x-axis when there's no label column
+			}
+			if len(valueCols) > 1 {
+				seriesLabels = columnNames(valueCols)
 			}
 		} else {
 			// JSON data
-			values = extractNumericArray(data)
+			series = [][]float64{extractNumericArray(data)}
 		}
-		
-		if len(values) == 0 {
+
+		if len(series) == 0 || len(series[0]) == 0 {
 			return nil, fmt.Errorf("plot widget: no numeric data found")
 		}
-		
+
 		plot := widgets.NewPlot()
-		plot.Data = [][]float64{values}
+		plot.Data = series
+		plot.DataLabels = seriesLabels
+		plot.XLabels = xLabels
 		if config.Title != "" {
 			plot.Title = config.Title
 		}
 		return plot, nil
 
 	case "sparkline":
-		var values []float64
-		
-		if csvData, ok := data.([][]string); ok && len(csvData) > 1 {
-			// CSV data
-			for i, row := range csvData {
-				if i == 0 {
-					continue // Skip header
-				}
-				if len(row) > 1 {
-					if val, err := strconv.ParseFloat(row[1], 64); err == nil {
-						values = append(values, val)
-					}
-				}
+		var series [][]float64
+		var titles []string
+
+		if tabular {
+			// one sparkline per --y column, titled by its header
+			labelCol, valueCols, err := chartColumns(ds, config)
+			if err != nil {
+				return nil, fmt.Errorf("sparkline widget: %w", err)
+			}
+			_, series = columnSeries(labelCol, valueCols)
+			if len(valueCols) > 1 {
+				titles = columnNames(valueCols)
 			}
 		} else {
 			// JSON data
-			values = extractNumericArray(data)
+			series = [][]float64{extractNumericArray(data)}
 		}
-		
-		if len(values) == 0 {
+
+		if len(series) == 0 || len(series[0]) == 0 {
 			return nil, fmt.Errorf("sparkline widget: no numeric data found")
 		}
-		
-		sparkline := widgets.NewSparkline()
-		sparkline.Data = values
+
+		sparklineGroup := widgets.NewSparklineGroup()
+		for i, values := range series {
+			sparkline := widgets.NewSparkline()
+			sparkline.Data = values
+			if i < len(titles) {
+				sparkline.Title = titles[i]
+			}
+			sparklineGroup.Sparklines = append(sparklineGroup.Sparklines, sparkline)
+		}
 		if config.Title != "" {
-			sparkline.Title = config.Title
+			if len(sparklineGroup.Sparklines) == 1 {
+				sparklineGroup.Sparklines[0].Title = config.Title
+			} else {
+				sparklineGroup.Title = config.Title
+			}
 		}
-		sparklineGroup := widgets.NewSparklineGroup(sparkline)
 		return sparklineGroup, nil
 
 	case "horizontal", "hbar", "horizontal-barchart":
 		// Horizontal bar chart - perfect for distributions
 		var values []float64
 		var labels []string
-		
-		if csvData, ok := data.([][]string); ok && len(csvData) > 1 {
-			// CSV data: first column = labels, second column = values
-			for i, row := range csvData {
-				if i == 0 {
-					continue // Skip header
-				}
-				if len(row) > 0 {
-					labels = append(labels, row[0])
-				}
-				if len(row) > 1 {
-					if val, err := strconv.ParseFloat(row[1], 64); err == nil {
-						values = append(values, val)
-					} else {
-						// If second column isn't numeric, try to extract from JSON structure
-						values = append(values, 0)
-					}
-				}
+
+		if tabular {
+			// labels from --x (or the first categorical column), values from the first --y column
+			labelCol, valueCols, err := chartColumns(ds, config)
+			if err != nil {
+				return nil, fmt.Errorf("horizontal-barchart widget: %w", err)
 			}
+			var series [][]float64
+			labels, series = columnSeries(labelCol, valueCols[:1])
+			values = series[0]
 		} else {
 			// JSON data - try to extract category/value pairs
 			values = extractNumericArray(data)
@@ -635,11 +1449,11 @@ func createWidget(widgetType string, data interface{}, config Config) (draw.Draw
 				}
 			}
 		}
-		
+
 		if len(values) == 0 {
 			return nil, fmt.Errorf("horizontal-barchart widget: no numeric data found")
 		}
-		
+
 		hbc := widgets.NewHorizontalBarChart()
 		hbc.Data = values
 		hbc.Labels = labels
@@ -648,12 +1462,74 @@ func createWidget(widgetType string, data interface{}, config Config) (draw.Draw
 		}
 		return hbc, nil
 
+	case "stacked", "stacked-barchart":
+		// Stacked bars: a two-key --group-by pivots into bars (first key) of segments (second key);
+		// otherwise each row is a bar and each --y column a segment
+		if !tabular {
+			return nil, fmt.Errorf("stacked-barchart widget: needs tabular data (CSV, TSV, NDJSON or --json-path)")
+		}
+		var labels []string
+		var bars [][]float64
+		title := ""
+		if ds.KeyColumns > 2 {
+			return nil, fmt.Errorf("stacked-barchart widget: --group-by has %d columns; stacked bars take two (bars, then segments)", ds.KeyColumns)
+		}
+		if ds.KeyColumns == 2 {
+			_, valueCols, err := chartColumns(ds, config)
+			if err != nil {
+				return nil, fmt.Errorf("stacked-barchart widget: %w", err)
+			}
+			var segments []string
+			labels, segments, bars, err = ds.Pivot(ds.Columns[0], ds.Columns[1], valueCols[0])
+			if err != nil {
+				return nil, fmt.Errorf("stacked-barchart widget: %w", err)
+			}
+			title = fmt.Sprintf("%s by %s (segments: %s)", valueCols[0].Name, ds.Columns[0].Name, strings.Join(segments, ", "))
+		} else {
+			labelCol, valueCols, err := chartColumns(ds, config)
+			if err != nil {
+				return nil, fmt.Errorf("stacked-barchart widget: %w", err)
+			}
+			if config.YAxis == "" {
+				// default: stack every numeric column
+				valueCols = nil
+				for _, col := range ds.NumericColumns() {
+					if col != labelCol {
+						valueCols = append(valueCols, col)
+					}
+				}
+			}
+			var series [][]float64
+			labels, series = columnSeries(labelCol, valueCols)
+			for i := range labels {
+				bar := make([]float64, len(series))
+				for j := range series {
+					bar[j] = series[j][i]
+				}
+				bars = append(bars, bar)
+			}
+			title = "Segments: " + strings.Join(columnNames(valueCols), ", ")
+		}
+
+		if len(bars) == 0 {
+			return nil, fmt.Errorf("stacked-barchart widget: no numeric data found")
+		}
+
+		sbc := widgets.NewStackedBarChart()
+		sbc.Data = bars
+		sbc.Labels = labels
+		sbc.Title = title
+		if config.Title != "" {
+			sbc.Title = config.Title
+		}
+		return sbc, nil
+
 	case "list":
 		var rows []string
-		
-		if csvData, ok := data.([][]string); ok {
-			// CSV data
-			for _, row := range csvData {
+
+		if tabular {
+			rows = append(rows, strings.Join(ds.Headers, " | "))
+			for _, row := range ds.Rows {
 				rows = append(rows, strings.Join(row, " | "))
 			}
 		} else {
@@ -670,7 +1546,7 @@ func createWidget(widgetType string, data interface{}, config Config) (draw.Draw
 				rows = append(rows, fmt.Sprintf("%v", data))
 			}
 		}
-		
+
 		list := widgets.NewList()
 		list.Rows = rows
 		if config.Title != "" {
@@ -683,44 +1559,237 @@ func createWidget(widgetType string, data interface{}, config Config) (draw.Draw
 	}
 }
 
+// applyColors overrides a widget's theme colors (bars, lines or sparklines, cycled); no-op when colors is empty
+func applyColors(widget draw.Drawable, colors []styling.Color) {
+	if len(colors) == 0 {
+		return
+	}
+	switch w := widget.(type) {
+	case *widgets.BarChart:
+		w.BarColors = colors
+	case *widgets.HorizontalBarChart:
+		w.BarColors = colors
+	case *widgets.StackedBarChart:
+		w.BarColors = colors
+	case *widgets.Plot:
+		w.LineColors = colors
+	case *widgets.SparklineGroup:
+		for i, sparkline := range w.Sparklines {
+			sparkline.LineColor = colors[i%len(colors)]
+		}
+	case *widgets.Table:
+		w.TextStyle.Fg = colors[0]
+	case *widgets.List:
+		w.TextStyle.Fg = colors[0]
+	case *widgets.Gauge:
+		w.BarColor = colors[0]
+	}
+}
+
+// maxHeldLog is how much of the log holdLog keeps; later lines are only counted
+const maxHeldLog = 64 << 10
+
+// heldLog collects the log package's output while the terminal UI runs, where writing to stderr
+// would scribble over the widgets
+type heldLog struct {
+	buf     bytes.Buffer
+	dropped int // lines that didn't fit in maxHeldLog
+}
+
+// holdLog sends the log package's output to a new heldLog until release
+func holdLog() *heldLog {
+	h := &heldLog{}
+	log.SetOutput(h)
+	return h
+}
+
+// Write keeps one log line (the log package serializes calls)
+func (h *heldLog) Write(p []byte) (int, error) {
+	if h.buf.Len()+len(p) > maxHeldLog {
+		h.dropped++
+		return len(p), nil
+	}
+	return h.buf.Write(p)
+}
+
+// release logs to stderr again and prints what was held; later calls print nothing
+func (h *heldLog) release() {
+	log.SetOutput(os.Stderr)
+	os.Stderr.Write(h.buf.Bytes())
+	if h.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "(%d more log lines dropped)\n", h.dropped)
+	}
+	h.buf.Reset()
+	h.dropped = 0
+}
+
 func main() {
 	config := Config{}
 
 	// Parse flags
 	var widgetStr string
-	flag.StringVar(&config.DataFile, "file", "", "Data file path (CSV, JSON, TXT)")
-	flag.StringVar(&config.MetricsURL, "metrics-url", "", "Metrics URL (e.g. http://localhost:9182/metrics)")
+	flag.StringVar(&config.DataFile, "file", "", "Data file path (CSV, JSON, TXT), or '-' for stdin")
+	var metricsURLs stringSlice
+	flag.Var(&metricsURLs, "metrics-url", "Metrics URL (e.g. http://localhost:9182/metrics, or host:port); repeat to scrape several targets, tagged with an instance label")
+	flag.StringVar(&config.TargetsFile, "targets", "", "File listing more --metrics-url targets: one host:port or URL per line, or a Prometheus file_sd JSON list")
+	flag.BoolVar(&config.SplitTargets, "split-targets", false, "One widget per target, laid out in a grid, instead of overlaying every target in one plot")
+	flag.StringVar(&config.Record, "record", "", "Append every raw --metrics-url scrape (time and page) to this file, for --replay")
+	flag.StringVar(&config.Replay, "replay", "", "Play back a --record file instead of scraping, through the same --metric expressions")
+	flag.StringVar(&config.Speed, "speed", "1x", "Replay speed: 10x, 0.5x, or max for no pauses")
+	flag.BoolVar(&config.System, "system", false, "Show this Linux machine's per-core CPU usage and frequency, memory, network and disk IO from /proc and /sys, every --interval")
+	flag.StringVar(&config.SystemRoot, "system-root", "/", "Read /proc and /sys for --system under this directory (e.g. a copy from another machine)")
+	flag.StringVar(&config.ListenStatsD, "listen-statsd", "", "Listen for StatsD counters, gauges, timers and sets on this UDP address (e.g. :8125), aggregated every --interval; --metric picks and computes series")
+	flag.StringVar(&config.PrometheusURL, "prometheus-url", "", "Prometheus-compatible server (Prometheus, Thanos, VictoriaMetrics; e.g. localhost:9090) to run --query against via /api/v1/query_range, starting with --history of past results")
+	var queries stringSlice
+	flag.Var(&queries, "query", "PromQL expression for --prometheus-url (repeatable), evaluated every --interval, e.g. 'rate(node_cpu_seconds_total{mode=\"user\"}[5m])'")
+	var alertRules stringSlice
+	flag.Var(&alertRules, "alert", "Alert rule on live lines (repeatable): '[name: ]expression op threshold [for duration]', e.g. 'slow core: windows_cpu_core_frequency_mhz < 1000 for 2m'; firing lines and borders turn red and a banner names the rule")
+	flag.BoolVar(&config.AlertBell, "alert-bell", false, "Ring the terminal bell when an --alert rule starts firing (on the terminal the dashboard draws on, so it rings even when stdout is redirected)")
+	flag.StringVar(&config.AlertCommand, "alert-command", "", "Shell command run when an --alert rule starts or stops firing; $CONSOLE_VIZ_ALERT, _STATE (firing/resolved), _RULE, _SERIES and _VALUE describe it")
 	var metricSelectors stringSlice
-	flag.Var(&metricSelectors, "metric", "Metric selector to graph (repeatable), e.g. go_gc_duration_seconds{quantile=\"0\"}; all appear on same graph")
-	flag.StringVar(&widgetStr, "widget", "table", "Widget type: table, barchart, horizontal, horizontal-barchart, plot, sparkline, list (comma-separated for multiple)")
-	flag.StringVar(&config.Layout, "layout", "", "Layout ratios: '80:20' or 'barchart:80,plot:20'")
+	flag.Var(&metricSelectors, "metric", "Metric selector to graph (repeatable), e.g. go_gc_duration_seconds{quantile=\"0\"} or cpu_seconds_total{mode=~\"user|system\"}; rate(), irate(), increase() and delta() with an optional [range] are computed across scrapes, histogram_quantile(0.99, x_bucket) estimates quantiles; all appear on same graph")
+	flag.DurationVar(&config.Interval, "interval", defaultInterval, "How often to scrape --metrics-url or run --exec, e.g. 1s, 500ms, 1m")
+	flag.StringVar(&config.History, "history", strconv.Itoa(defaultHistory), "Scrapes kept per metrics line: a count (120) or a duration (30m, 24h) at --interval")
+	flag.DurationVar(&config.ScrapeTimeout, "scrape-timeout", 0, "Give up on a scrape after this long (default --interval, at most 10s)")
+	flag.StringVar(&config.BearerToken, "bearer-token", "", "Bearer token for --metrics-url (or set "+envBearerToken+")")
+	flag.StringVar(&config.BearerTokenFile, "bearer-token-file", "", "File holding the bearer token, re-read on every scrape (or set "+envBearerTokenFile+")")
+	flag.StringVar(&config.BasicAuth, "basic-auth", "", "Basic auth for --metrics-url as user:password (or set "+envBasicAuth+")")
+	flag.StringVar(&config.CAFile, "ca-file", "", "PEM CA bundle to verify the metrics server with")
+	flag.StringVar(&config.CertFile, "cert-file", "", "Client certificate (PEM) for mutual TLS, with --key-file")
+	flag.StringVar(&config.KeyFile, "key-file", "", "Client certificate key (PEM) for mutual TLS")
+	flag.BoolVar(&config.InsecureSkipVerify, "insecure-skip-verify", false, "Don't verify the metrics server's TLS certificate")
+	flag.StringVar(&config.Exec, "exec", "", "Shell command to run every --interval; numbers and key: value pairs in its output are graphed, e.g. 'df --output=pcent /'")
+	flag.StringVar(&config.ExecPattern, "exec-pattern", "", "Regex pulling fields out of the --exec output; groups (?P<name>...) and (?P<value>...), or (name)(value), or (value)")
+	flag.DurationVar(&config.ExecTimeout, "exec-timeout", 0, "Kill an --exec run that takes longer than this (default --interval)")
+	flag.StringVar(&widgetStr, "widget", "table", "Widget type: table, barchart, horizontal, horizontal-barchart, stacked-barchart, plot, sparkline, list (comma-separated for multiple); plot, sparkline or gauge for live sources")
+	flag.StringVar(&config.Layout, "layout", "", "Layout ratios: '80:20' or 'barchart:80,plot:20', or nested rows/columns: 'row(60: col(70:barchart, 30:table), 40: plot)'")
 	flag.StringVar(&config.Columns, "columns", "", "Column selection: '1-3' or 'name,value'")
+	flag.StringVar(&config.XAxis, "x", "", "Label/x-axis column for charts (name or 1-based index)")
+	flag.StringVar(&config.YAxis, "y", "", "Value column(s) for charts, comma-separated (names or 1-based indices); plot draws one line per column")
+	flag.StringVar(&config.GroupBy, "group-by", "", "Group rows by these column(s), comma-separated; two keys feed the stacked-barchart widget")
+	flag.StringVar(&config.Agg, "agg", "", "Aggregation for --group-by: sum (default), avg, min, max, count, median, p95 (any pNN)")
 	flag.StringVar(&config.Rows, "rows", "", "Row selection: '1-100' or '-50' (last 50)")
 	flag.IntVar(&config.SkipRows, "skip-rows", 0, "Skip first N rows")
 	flag.IntVar(&config.Limit, "limit", 0, "Limit number of rows")
 	flag.StringVar(&config.Theme, "theme", "", "Theme: dark, light, default")
 	flag.StringVar(&config.Title, "title", "", "Widget title")
-	flag.StringVar(&config.Format, "format", "", "Force format: csv, json, txt")
+	flag.StringVar(&config.Format, "format", "", "Force format: csv, tsv, psv, json, ndjson (JSON Lines), txt (sniffed for stdin)")
+	flag.StringVar(&config.JSONPath, "json-path", "", "JSONPath selecting the values to chart, e.g. '$.categories[*].value' or '$.items[?(@.active)].score'")
+	flag.StringVar(&config.JSONLabelPath, "json-label-path", "", "JSONPath selecting the labels for --json-path values, e.g. '$.categories[*].name'")
+	flag.StringVar(&config.Delimiter, "delimiter", "auto", "Field delimiter for delimited files: ',', 'tab', '|', ';' or 'auto' to sniff it")
+	flag.StringVar(&config.Comment, "comment", "", "Skip lines starting with this character in delimited files (e.g. '#')")
+	flag.BoolVar(&config.LazyQuotes, "lazy-quotes", false, "Tolerate stray or unescaped quotes in delimited files")
+	flag.BoolVar(&config.VariableFields, "variable-fields", false, "Allow rows with a varying number of fields in delimited files")
+	var snapshot snapshotFlag
+	flag.Var(&snapshot, "snapshot", "Print the widgets once to stdout and exit, no terminal needed; optional size WxH (default $COLUMNS x $LINES or 100x30)")
+	var colorMode string
+	flag.StringVar(&colorMode, "color", "auto", "Snapshot colors: auto (ANSI when stdout is a terminal), always, never")
+	flag.StringVar(&config.ConfigFile, "config", "", "Dashboard config file (JSON or YAML): sources, widgets, nested layout and refresh intervals")
 	flag.Parse()
 	config.Metrics = []string(metricSelectors)
+	config.Alerts = []string(alertRules)
+	config.Queries = []string(queries)
+	config.MetricsURLs = []string(metricsURLs)
+	if config.TargetsFile != "" {
+		targets, err := collector.LoadTargets(config.TargetsFile)
+		if err != nil {
+			log.Fatalf("Failed to load --targets: %v", err)
+		}
+		config.MetricsURLs = append(config.MetricsURLs, targets...)
+	}
+	config.MetricsURLs = collector.NormalizeTargets(config.MetricsURLs)
+	if config.Interval <= 0 {
+		log.Fatalf("Invalid --interval %s: must be positive", config.Interval)
+	}
 
 	// Get data file from args if not in flag
 	if config.DataFile == "" && len(flag.Args()) > 0 {
 		config.DataFile = flag.Args()[0]
 	}
+	// data piped in with no file given: read it from stdin (e.g. kubectl ... | console-viz)
+	if config.DataFile == "" && !config.live() && config.ConfigFile == "" && stdinIsPiped() {
+		config.DataFile = "-"
+	}
 
-	if config.DataFile == "" && config.MetricsURL == "" {
+	if config.DataFile == "" && !config.live() && config.ConfigFile == "" {
 		fmt.Fprintf(os.Stderr, "Usage: console-viz <data-file> [options] OR console-viz --metrics-url=URL [options]\n")
+		fmt.Fprintf(os.Stderr, "       Read from stdin: <command> | console-viz [options] (or pass '-' as the data file)\n")
 		fmt.Fprintf(os.Stderr, "       With custom metrics: --metrics-url=URL --metric 'name{label=\"val\"}' (repeat -metric for more lines)\n")
+		fmt.Fprintf(os.Stderr, "       Several hosts: --metrics-url=host1:9100 --metrics-url=host2:9100 (or --targets hosts.txt) [--split-targets]\n")
+		fmt.Fprintf(os.Stderr, "       Record and replay: --metrics-url=URL --record scrapes.rec, later --replay scrapes.rec [--speed 10x]\n")
+		fmt.Fprintf(os.Stderr, "       Linux system overview (CPU, memory, network, disk): console-viz --system --interval 2s\n")
+		fmt.Fprintf(os.Stderr, "       Alert on live lines: --alert 'slow core: windows_cpu_core_frequency_mhz < 1000 for 2m' [--alert-bell] [--alert-command CMD]\n")
+		fmt.Fprintf(os.Stderr, "       StatsD over UDP: console-viz --listen-statsd :8125 --interval 10s [--metric 'jobs_done']\n")
+		fmt.Fprintf(os.Stderr, "       PromQL with history: console-viz --prometheus-url localhost:9090 --query 'rate(http_requests_total[5m])' --interval 15s --history 1h\n")
+		fmt.Fprintf(os.Stderr, "       Chart a command's output: console-viz --exec 'df --output=pcent /' --interval 5s\n")
+		fmt.Fprintf(os.Stderr, "       Dashboard from a config file: console-viz --config=dashboard.yaml\n")
 		fmt.Fprintf(os.Stderr, "\nOptions:\n")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
-	if len(config.Metrics) > 0 && config.MetricsURL == "" {
-		fmt.Fprintf(os.Stderr, "Error: --metric requires --metrics-url\n")
+	if len(config.Metrics) > 0 && len(config.MetricsURLs) == 0 && config.Replay == "" && config.ListenStatsD == "" {
+		fmt.Fprintf(os.Stderr, "Error: --metric requires --metrics-url or --listen-statsd\n")
+		os.Exit(1)
+	}
+	if config.SplitTargets && len(config.MetricsURLs) == 0 && config.Replay == "" {
+		fmt.Fprintf(os.Stderr, "Error: --split-targets requires --metrics-url or --targets\n")
+		os.Exit(1)
+	}
+	if config.Record != "" && len(config.MetricsURLs) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: --record requires --metrics-url\n")
+		os.Exit(1)
+	}
+	if config.System && (len(config.MetricsURLs) > 0 || config.Exec != "" || config.Replay != "") {
+		fmt.Fprintf(os.Stderr, "Error: --system reads this machine directly; drop --metrics-url, --exec and --replay\n")
+		os.Exit(1)
+	}
+	if config.ListenStatsD != "" && (len(config.MetricsURLs) > 0 || config.Exec != "" || config.Replay != "" || config.System) {
+		fmt.Fprintf(os.Stderr, "Error: --listen-statsd receives metrics instead of collecting them; drop --metrics-url, --exec, --replay and --system\n")
+		os.Exit(1)
+	}
+	if (config.PrometheusURL == "") != (len(config.Queries) == 0) {
+		fmt.Fprintf(os.Stderr, "Error: --prometheus-url and --query go together\n")
+		os.Exit(1)
+	}
+	if config.PrometheusURL != "" && (len(config.MetricsURLs) > 0 || config.Exec != "" || config.Replay != "" || config.System || config.ListenStatsD != "") {
+		fmt.Fprintf(os.Stderr, "Error: --prometheus-url queries a server instead of collecting; drop --metrics-url, --exec, --replay, --system and --listen-statsd\n")
+		os.Exit(1)
+	}
+	if config.Replay != "" && (len(config.MetricsURLs) > 0 || config.Exec != "") {
+		fmt.Fprintf(os.Stderr, "Error: --replay plays a recording instead of scraping; drop --metrics-url and --exec\n")
+		os.Exit(1)
+	}
+	if len(config.MetricsURLs) > 0 && config.Exec != "" {
+		fmt.Fprintf(os.Stderr, "Error: use either --metrics-url or --exec (a --config dashboard can show both)\n")
 		os.Exit(1)
 	}
 
+	// Nested --layout grammar, e.g. "row(60: col(70:barchart, 30:table), 40: plot)"; its leaves name the widgets
+	var layoutRoot *dashboard.Node
+	if dashboard.IsLayoutExpr(config.Layout) && config.ConfigFile == "" {
+		if config.live() {
+			log.Fatalf("Error: nested --layout needs a data file (metrics and exec modes show a single widget)")
+		}
+		var err error
+		layoutRoot, err = dashboard.ParseLayout(config.Layout)
+		if err != nil {
+			log.Fatalf("Failed to parse layout: %v", err)
+		}
+	}
+
+	// Dashboard config: the spec describes sources and widgets; --theme still wins over its theme
+	var spec *dashboard.Spec
+	if config.ConfigFile != "" {
+		var err error
+		spec, err = dashboard.Load(config.ConfigFile)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		if config.Theme == "" {
+			config.Theme = spec.Theme
+		}
+	}
+
 	// Initialize theme
 	// Check if theme was set via flag first
 	if config.Theme != "" {
@@ -735,68 +1804,94 @@ func main() {
 		}
 	}
 
-	// Initialize terminal
-	if err := draw.Init(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to initialize terminal: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Make sure you're running in a real terminal (not piping output)\n")
-		fmt.Fprintf(os.Stderr, "Try running: go run ./cmd/console-viz/main.go <file> [options]\n")
-		os.Exit(1)
-	}
-	defer draw.Close()
-
-	draw.InitRenderer()
-
-	// metrics mode: plot (line graph) from metrics URL
-	var metricsPlot *widgets.Plot
-	var frequencyHistories [][]float64 // CPU frequency mode (no -metric): one history per core
-	var genericHistories [][]float64   // generic -metric mode: one history per metric selector
-	useGenericMetrics := len(config.Metrics) > 0
-	var lastMetricsError string
-	maxHistory := 120
-
-	// branch: metrics mode vs file mode
+	// branch: dashboard config vs metrics mode vs file mode
 	var widgetList []draw.Drawable
-	if config.MetricsURL != "" {
-		plot := widgets.NewPlot()
-		plot.Data = [][]float64{}
-		plot.ShowAxes = true
-		plot.PlotType = widgets.LineChart
-		plot.LineColors = styling.StandardColors
-		if config.Title != "" {
-			plot.Title = config.Title
-		} else if useGenericMetrics {
-			plot.Title = "Metrics"
-			plot.DataLabels = config.Metrics // legend on the right: each --metric appears with its line color
-		} else {
-			plot.Title = "CPU frequency MHz"
+	var layout *draw.Layout   // nested row/column layout (--config or --layout grammar); nil uses the --layout ratio strip
+	var panels []*sourcePanel // widgets fed by live sources (metrics scrapes)
+	var schedules []*schedule // widgets rebuilt on an interval (reloaded files)
+	if spec != nil {
+		var err error
+		layout, widgetList, panels, schedules, err = buildDashboard(spec, config)
+		if err != nil {
+			log.Fatalf("Failed to build dashboard from %s: %v", config.ConfigFile, err)
 		}
-		metricsPlot = plot
-		widgetList = []draw.Drawable{metricsPlot}
-	} else {
-		// file mode: existing logic (load file, create widgets from file data)
-		// Detect file format
-		ext := strings.ToLower(filepath.Ext(config.DataFile))
-		if config.Format == "" {
-			config.Format = ext[1:] // Remove dot
+	} else if config.live() {
+		// metrics/exec mode: plot (line graph), sparklines or gauge fed by a live source, which collects once as soon as it starts
+		capacity, err := parseHistory(config.History, config.Interval)
+		if err != nil {
+			log.Fatalf("Invalid --history: %v", err)
 		}
-
-		// Load data
-		var data interface{}
-		var err error
-
-		switch config.Format {
-		case "csv":
-			data, err = loadCSV(config.DataFile, config)
+		httpCfg, err := scrapeConfig(config)
+		if err != nil {
+			log.Fatalf("Invalid scrape options: %v", err)
+		}
+		option, kind, cfg := "--metrics-url", "prometheus", collector.SourceConfig{Targets: config.MetricsURLs, Exprs: config.Metrics, Interval: config.Interval, HTTP: httpCfg}
+		targets := config.MetricsURLs
+		switch {
+		case config.Exec != "":
+			option, kind, cfg = "--exec", "exec", collector.SourceConfig{Command: config.Exec, Pattern: config.ExecPattern, Interval: config.Interval, Timeout: config.ExecTimeout}
+		case config.ListenStatsD != "":
+			option, kind, cfg = "--listen-statsd", "statsd", collector.SourceConfig{URL: config.ListenStatsD, Exprs: config.Metrics, Interval: config.Interval}
+		case config.PrometheusURL != "":
+			option, kind, cfg = "--prometheus-url", "promql", collector.SourceConfig{URL: config.PrometheusURL, Exprs: config.Queries, Interval: config.Interval, HTTP: httpCfg}
+		case config.Replay != "":
+			speed, err := parseSpeed(config.Speed)
 			if err != nil {
-				log.Fatalf("Failed to load CSV: %v", err)
+				log.Fatalf("Invalid --speed: %v", err)
 			}
-		case "json":
-			data, err = loadJSON(config.DataFile)
+			if snapshot.enabled {
+				speed = 0 // a snapshot shows the end of the recording
+			}
+			option, kind, cfg = "--replay", "replay", collector.SourceConfig{URL: config.Replay, Exprs: config.Metrics, Interval: config.Interval, Speed: speed}
+			if config.SplitTargets {
+				if targets, err = collector.RecordedTargets(config.Replay); err != nil {
+					log.Fatalf("Invalid --replay: %v", err)
+				}
+			}
+		case config.Record != "":
+			recorder, err := collector.NewRecorder(config.Record)
 			if err != nil {
-				log.Fatalf("Failed to load JSON: %v", err)
+				log.Fatalf("Invalid --record: %v", err)
 			}
-		default:
-			log.Fatalf("Unsupported format: %s", config.Format)
+			defer recorder.Close()
+			cfg.Recorder = recorder
+		}
+		// the --widget default (table) means "not given": live sources default to a plot
+		widgetType := ""
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "widget" {
+				widgetType = strings.ToLower(strings.TrimSpace(widgetStr))
+			}
+		})
+		if config.System {
+			layout, panels, err = systemPanels(config.SystemRoot, config.Interval, widgetType, capacity)
+			if err != nil {
+				log.Fatalf("Invalid --system: %v", err)
+			}
+			for _, panel := range panels {
+				widgetList = append(widgetList, panel.widget())
+			}
+		} else if config.SplitTargets && len(targets) > 1 {
+			layout, panels, err = targetPanels(targets, kind, cfg, widgetType, config.Title, capacity)
+			if err != nil {
+				log.Fatalf("Invalid %s: %v", option, err)
+			}
+			for _, panel := range panels {
+				widgetList = append(widgetList, panel.widget())
+			}
+		} else {
+			panel, err := newLivePanel(kind, cfg, widgetType, config.Title, capacity)
+			if err != nil {
+				log.Fatalf("Invalid %s: %v", option, err)
+			}
+			panels = append(panels, panel)
+			widgetList = []draw.Drawable{panel.widget()}
+		}
+	} else {
+		// file mode: load file, create widgets from file data
+		data, err := loadFileData(config)
+		if err != nil {
+			log.Fatalf("Failed to load data: %v", err)
 		}
 
 		// Parse widgets (normalize to lowercase so "Horizontal-Barchart" matches)
@@ -816,26 +1911,41 @@ func main() {
 			log.Printf("DEBUG: widgetStr value: '%s'", widgetStr)
 		}
 
-		// Create widgets
+		// Create widgets (a nested layout names its own widgets)
 		widgetList = []draw.Drawable{}
-		for _, widgetType := range widgetTypes {
+		create := func(widgetType string) draw.Drawable {
 			widget, err := createWidget(widgetType, data, config)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: Failed to create widget '%s': %v\n", widgetType, err)
-				fmt.Fprintf(os.Stderr, "Available widgets: table, barchart, horizontal, horizontal-barchart, plot, sparkline, list\n")
+				fmt.Fprintf(os.Stderr, "Available widgets: table, barchart, horizontal, horizontal-barchart, stacked-barchart, plot, sparkline, list\n")
 				fmt.Fprintf(os.Stderr, "\nTip: Make sure your data contains numeric values for chart widgets.\n")
 				os.Exit(1)
 			}
 			widgetList = append(widgetList, widget)
+			return widget
+		}
+		if layoutRoot != nil {
+			// create exits on failure, so building can't return an error
+			layout, _ = dashboard.Build(layoutRoot, func(w *dashboard.Widget) (draw.Drawable, error) {
+				return create(w.Type), nil
+			})
+		} else {
+			for _, widgetType := range widgetTypes {
+				create(widgetType)
+			}
 		}
 	}
-	
+
 	if len(widgetList) == 0 {
 		log.Fatalf("Error: No widgets were created. Check your data format and widget type.")
 	}
 
-	// Parse layout ratios
-	ratios, err := parseLayout(config.Layout, len(widgetList))
+	// Parse layout ratios (the horizontal strip used when there is no nested layout)
+	var ratios []float64
+	var err error
+	if layout == nil {
+		ratios, err = parseLayout(config.Layout, len(widgetList))
+	}
 	if err != nil {
 		log.Printf("Warning: Failed to parse layout: %v, using equal distribution", err)
 		ratios = make([]float64, len(widgetList))
@@ -844,63 +1954,123 @@ func main() {
 		}
 	}
 
+	// alert rules from the flags and the dashboard config, checked after every live batch
+	rules := config.Alerts
+	if spec != nil {
+		rules = append(rules, spec.Alerts...)
+	}
+	// a snapshot's stdout is the picture; no bell in it
+	alerts, err := newAlerter(rules, config.AlertBell && !snapshot.enabled, config.AlertCommand)
+	if err != nil {
+		log.Fatalf("Invalid --alert: %v", err)
+	}
+	if alerts != nil && len(panels) == 0 {
+		log.Fatalf("Error: --alert needs a live source (--metrics-url, --exec, --replay, --system, --listen-statsd, --prometheus-url or one in --config)")
+	}
+	alerts.warnHistory(panels)
+
+	// arrange sizes the widgets for the terminal (at startup and on resize)
+	arrange := func(width, height int) {
+		if alerts != nil {
+			// the alert banner takes the free last line
+			alerts.banner.SetRect(0, height-1, width, height)
+		}
+		if layout != nil {
+			// leave the last line free, like the ratio strip
+			layout.SetRect(0, 0, width, height-1)
+			return
+		}
+		applyLayout(width, height, ratios, widgetList)
+	}
+	// screen is what gets drawn: the nested layout, or the widgets of the ratio strip
+	screen := func() []draw.Drawable {
+		items := widgetList
+		if layout != nil {
+			items = []draw.Drawable{layout}
+		}
+		if alerts != nil {
+			items = append(items[:len(items):len(items)], alerts.banner)
+		}
+		return items
+	}
+
+	// --snapshot: draw once to stdout and exit, no terminal needed (CI logs, chat)
+	if snapshot.enabled {
+		// live widgets show their first batch
+		collectFirst(panels, alerts)
+		// arrange leaves the terminal's last line free; a snapshot uses every line, unless the
+		// alert banner needs it
+		if alerts != nil {
+			arrange(snapshot.width, snapshot.height)
+		} else {
+			arrange(snapshot.width, snapshot.height+1)
+		}
+		if err := draw.Snapshot(os.Stdout, snapshot.width, snapshot.height, useColor(colorMode), screen()...); err != nil {
+			log.Fatalf("Failed to write snapshot: %v", err)
+		}
+		alerts.wait()
+		return
+	}
+
+	// the screen belongs to the widgets from here on: what gets logged (alert hook failures,
+	// reload warnings) is printed once the terminal is restored
+	logs := holdLog()
+	defer logs.release() // runs after draw.Close below
+
+	// Initialize terminal (termbox reads keys from /dev/tty, or CONIN$ on Windows, so this works
+	// when stdin was the data pipe)
+	if err := draw.Init(); err != nil {
+		logs.release()
+		fmt.Fprintf(os.Stderr, "Error: Failed to initialize terminal: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Make sure you're running in a real terminal (not piping output), or use --snapshot\n")
+		fmt.Fprintf(os.Stderr, "Try running: go run ./cmd/console-viz/main.go <file> [options]\n")
+		os.Exit(1)
+	}
+	defer draw.Close()
+
+	draw.InitRenderer()
+	render := func() {
+		draw.Render(screen()...)
+	}
+
 	// Get terminal dimensions for initial layout
 	width, height := draw.TerminalDimensions()
-	// use shared helper so we can re-run the same layout on resize
-	applyLayout(width, height, ratios, widgetList)
+	arrange(width, height)
 
 	// Clear screen with theme background (so --theme=dark gives full dark mode)
 	draw.Clear()
 
-	// if metrics mode: do initial fetch immediately so graph shows data right away
-	if metricsPlot != nil {
-		if useGenericMetrics {
-			snapshot, err := collector.FetchGenericMetrics(config.MetricsURL, config.Metrics)
-			if err != nil {
-				lastMetricsError = err.Error()
-				log.Printf("initial metrics fetch: %v", err)
-				metricsPlot.Title = "Metrics | Error: " + truncateError(lastMetricsError)
-			} else {
-				lastMetricsError = ""
-				for len(genericHistories) < len(snapshot.Values) {
-					genericHistories = append(genericHistories, nil)
-				}
-				for i := range snapshot.Values {
-					genericHistories[i] = append(genericHistories[i], snapshot.Values[i])
-				}
-				metricsPlot.Data = genericHistories
-			}
-		} else {
-			snapshot, err := collector.FetchCPUFrequency(config.MetricsURL)
-			if err != nil {
-				lastMetricsError = err.Error()
-				log.Printf("initial metrics fetch: %v", err)
-				metricsPlot.Title = "core 0,0 MHz | Error: " + truncateError(lastMetricsError)
-			} else {
-				lastMetricsError = ""
-				if len(snapshot.Cores) > 0 {
-					for len(frequencyHistories) < len(snapshot.Cores) {
-						frequencyHistories = append(frequencyHistories, nil)
-					}
-					for i := range snapshot.Cores {
-						frequencyHistories[i] = append(frequencyHistories[i], snapshot.Cores[i].Mhz)
-					}
-					metricsPlot.Data = frequencyHistories
-				}
+	// Render once before entering the event loop (live widgets fill in as their first batch arrives)
+	render()
+
+	// Start the live sources; each sends batches on its own schedule
+	batches := make(chan collector.Batch)
+	bySource := map[collector.Source]*sourcePanel{}
+	for _, p := range panels {
+		bySource[p.source] = p
+		p.source.Start(batches)
+		defer p.source.Stop()
+	}
+
+	// Reload files on the shortest configured interval; each one is only refreshed when due
+	var tick <-chan time.Time
+	if len(schedules) > 0 {
+		interval := schedules[0].interval
+		for _, s := range schedules[1:] {
+			if s.interval < interval {
+				interval = s.interval
 			}
 		}
+		ticker := time.NewTicker(interval)
+		// stop the ticker when we exit so we don't leak it
+		defer ticker.Stop()
+		tick = ticker.C
 	}
 
-	// Render once before entering the event loop (in metrics mode: shows first data point; in file mode: shows file data)
-	draw.Render(widgetList...)
-
-	// Refresh interval for live data (e.g. fetch metrics every 15s)
-	ticker := time.NewTicker(15 * time.Second)
-	// stop the ticker when we exit so we don't leak it
-	defer ticker.Stop()
-
-	// Event loop: react to keyboard, resize, and timer (for future metrics fetch + graph update)
+	// Event loop: react to keyboard, resize, live source batches and the file reload timer
 	eventCh := draw.PollEvents()
+	updated := false                             // a batch changed a widget since the last draw
+	backfilling := map[collector.Source]bool{} // sources partway through a backfill
 	for {
 		select {
 		// user input or terminal resize
@@ -916,68 +2086,69 @@ func main() {
 				// tell the renderer the terminal size changed so its frame buffer is correct
 				draw.ResizeRenderer(r.Width, r.Height)
 				// recompute widget rectangles for the new size
-				applyLayout(r.Width, r.Height, ratios, widgetList)
+				arrange(r.Width, r.Height)
 				// clear screen then redraw so resized layout looks correct
 				draw.Clear()
-				draw.Render(widgetList...)
-			}
-		// every 15s: fetch metrics from Windows Exporter then redraw (graph update in real time)
-		case <-ticker.C:
-			if metricsPlot != nil {
-				if useGenericMetrics {
-					snapshot, err := collector.FetchGenericMetrics(config.MetricsURL, config.Metrics)
-					if err != nil {
-						lastMetricsError = err.Error()
-						log.Printf("metrics fetch: %v", err)
-						metricsPlot.Title = "Metrics | Error: " + truncateError(lastMetricsError)
-					} else {
-						lastMetricsError = ""
-						for len(genericHistories) < len(snapshot.Values) {
-							genericHistories = append(genericHistories, nil)
-						}
-						for i := range snapshot.Values {
-							genericHistories[i] = append(genericHistories[i], snapshot.Values[i])
-							if len(genericHistories[i]) > maxHistory {
-								genericHistories[i] = genericHistories[i][len(genericHistories[i])-maxHistory:]
-							}
-						}
-						metricsPlot.Data = genericHistories
-						if config.Title != "" {
-							metricsPlot.Title = config.Title
-						} else {
-							metricsPlot.Title = "Metrics"
-						}
+				render()
+			}
+		// a live source collected: update its widget and redraw
+		case batch := <-batches:
+			// sources finishing together are drawn once
+		drain:
+			for {
+				if p, ok := bySource[batch.Source]; ok {
+					p.update(batch)
+					if batch.Busy == "" && !batch.More {
+						alerts.check(p)
 					}
+					updated = true
+				}
+				// the rest of a backfill is on its way: draw it all at once, when it's in
+				if batch.More {
+					backfilling[batch.Source] = true
 				} else {
-					snapshot, err := collector.FetchCPUFrequency(config.MetricsURL)
-					if err != nil {
-						lastMetricsError = err.Error()
-						log.Printf("metrics fetch: %v", err)
-						metricsPlot.Title = "core 0,0 MHz | Error: " + truncateError(lastMetricsError)
-					} else {
-						lastMetricsError = ""
-						if len(snapshot.Cores) > 0 {
-							for len(frequencyHistories) < len(snapshot.Cores) {
-								frequencyHistories = append(frequencyHistories, nil)
-							}
-							for i := range snapshot.Cores {
-								frequencyHistories[i] = append(frequencyHistories[i], snapshot.Cores[i].Mhz)
-								if len(frequencyHistories[i]) > maxHistory {
-									frequencyHistories[i] = frequencyHistories[i][len(frequencyHistories[i])-maxHistory:]
-								}
-							}
-							metricsPlot.Data = frequencyHistories
-						}
-						if config.Title != "" {
-							metricsPlot.Title = config.Title
-						} else {
-							metricsPlot.Title = "CPU frequency MHz"
-						}
+					delete(backfilling, batch.Source)
+				}
+				select {
+				case batch = <-batches:
+				default:
+					break drain
+				}
+			}
+			if updated && len(backfilling) == 0 {
+				render()
+				updated = false
+			}
+		// refresh every widget that is due, swapping in rebuilt widgets, then redraw if any changed
+		case now := <-tick:
+			changed := false
+			for _, s := range schedules {
+				if now.Before(s.next) {
+					continue
+				}
+				s.next = now.Add(s.interval)
+				old := s.panel.widget()
+				widget := s.panel.refresh()
+				if widget == old {
+					continue
+				}
+				changed = true
+				for i := range widgetList {
+					if widgetList[i] == old {
+						widgetList[i] = widget
 					}
 				}
+				if layout != nil {
+					layout.Replace(old, widget)
+				} else {
+					width, height := draw.TerminalDimensions()
+					applyLayout(width, height, ratios, widgetList)
+				}
+				draw.Clear()
+			}
+			if changed {
+				render()
 			}
-			// redraw so terminal graph updates every 15s (in metrics mode: shows new frequency point; in file mode: just refreshes)
-			draw.Render(widgetList...)
 		}
 	}
 }
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"console-viz/collector"
+	"console-viz/dashboard"
+	"console-viz/draw"
+	"console-viz/styling"
+	"console-viz/widgets"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// livePanel is a widget rebuilt on an interval (reloaded data files)
+type livePanel interface {
+	// widget returns the widget currently on screen
+	widget() draw.Drawable
+	// refresh updates the data and returns the widget to show; when it differs from the current
+	// one the caller swaps it into the layout
+	refresh() draw.Drawable
+}
+
+// schedule tracks when a live panel is next due
+type schedule struct {
+	panel    livePanel
+	interval time.Duration
+	next     time.Time
+}
+
+// defaultInterval is how often live sources collect when --interval isn't given
+const defaultInterval = 15 * time.Second
+
+// defaultHistory is how many batches each live line keeps when --history isn't given
+const defaultHistory = 120
+
+// sourcePanel is a widget fed by a live collector.Source: a line graph with one line per series
+// the source reports (e.g. every series matched by the --metric selectors), a sparkline per
+// series, or a gauge showing the latest value of the first series; updated on every batch
+type sourcePanel struct {
+	plot       *widgets.Plot           // when graphing
+	sparklines *widgets.SparklineGroup // when drawing a sparkline per series
+	gauge      *widgets.Gauge          // when showing the latest value
+	source     collector.Source
+	title      string             // user title; "" uses the source's
+	lines      map[string]int     // series key => line index
+	series     []collector.Sample // latest sample of each line, for the legend
+	groups     []string           // group each line came from (its legend when nothing else distinguishes it)
+	history    *collector.History // one series per line; NaN where the series was missing from a batch
+	span       time.Duration      // time the history covers once full (0 when unknown)
+
+	// the widget's own colors, restored when no alert fires (see highlight)
+	styled     bool
+	border     styling.Style
+	lineColors []styling.Color
+	barColor   styling.Color
+	sparkColor styling.Color // what new sparklines are drawn in
+}
+
+// liveWidgetTypes are the widgets a live source can feed ("" is plot)
+var liveWidgetTypes = map[string]bool{"": true, "plot": true, "sparkline": true, "gauge": true}
+
+// newSourcePanel creates the widget (empty until the first batch) keeping the last history batches
+func newSourcePanel(source collector.Source, widgetType, title string, history int) (*sourcePanel, error) {
+	if !liveWidgetTypes[widgetType] {
+		return nil, fmt.Errorf("live sources can only feed a plot, sparkline or gauge, not %s", widgetType)
+	}
+	m := &sourcePanel{source: source, title: title, lines: map[string]int{}, history: collector.NewHistory(history)}
+	switch widgetType {
+	case "gauge":
+		m.gauge = widgets.NewGauge()
+		m.gauge.Label = "waiting for data"
+		m.gauge.Title = m.defaultTitle()
+		return m, nil
+	case "sparkline":
+		m.sparklines = widgets.NewSparklineGroup()
+		m.sparklines.Title = m.defaultTitle()
+		m.sparkColor = widgets.NewSparkline().LineColor
+		return m, nil
+	}
+	plot := widgets.NewPlot()
+	plot.Data = [][]float64{}
+	plot.ShowAxes = true
+	plot.PlotType = widgets.LineChart
+	plot.DrawDirection = widgets.DrawLeft // once the history is wider than the plot, keep the newest scrapes in view
+	plot.LineColors = styling.StandardColors
+	plot.Title = m.defaultTitle()
+	m.plot = plot
+	return m, nil
+}
+
+// newLivePanel creates a widget fed by a new source of the given kind; sources that can load
+// past data start with as much of it as the widget keeps
+func newLivePanel(kind string, cfg collector.SourceConfig, widgetType, title string, history int) (*sourcePanel, error) {
+	if cfg.Range == 0 {
+		cfg.Range = time.Duration(history-1) * cfg.Interval
+	}
+	source, err := collector.NewSource(kind, cfg)
+	if err != nil {
+		return nil, err
+	}
+	panel, err := newSourcePanel(source, widgetType, title, history)
+	if err != nil {
+		return nil, err
+	}
+	panel.span = time.Duration(panel.history.Cap()-1) * cfg.Interval
+	return panel, nil
+}
+
+// targetPanels creates one widget per scrape target (each with its own source of the given kind
+// limited to that target, titled with the target's instance), laid out in a grid
+func targetPanels(targets []string, kind string, cfg collector.SourceConfig, widgetType, title string, history int) (*draw.Layout, []*sourcePanel, error) {
+	panels := make([]*sourcePanel, len(targets))
+	for i, target := range targets {
+		cfg.Targets = []string{target}
+		panelTitle := collector.Instance(target)
+		if title != "" {
+			panelTitle = title + " @ " + panelTitle
+		}
+		panel, err := newLivePanel(kind, cfg, widgetType, panelTitle, history)
+		if err != nil {
+			return nil, nil, err
+		}
+		panels[i] = panel
+	}
+	layout, err := gridLayout(panels)
+	if err != nil {
+		return nil, nil, err
+	}
+	return layout, panels, nil
+}
+
+// systemPanels creates one widget per system view (CPU, frequency, memory, network, disk) read
+// from /proc and /sys under root, laid out in a grid
+func systemPanels(root string, interval time.Duration, widgetType string, history int) (*draw.Layout, []*sourcePanel, error) {
+	panels := make([]*sourcePanel, len(collector.SystemViews))
+	for i, view := range collector.SystemViews {
+		cfg := collector.SourceConfig{Exprs: []string{view}, Root: root, Interval: interval}
+		panel, err := newLivePanel("system", cfg, widgetType, "", history)
+		if err != nil {
+			return nil, nil, err
+		}
+		panels[i] = panel
+	}
+	layout, err := gridLayout(panels)
+	if err != nil {
+		return nil, nil, err
+	}
+	return layout, panels, nil
+}
+
+// gridLayout arranges the panels' widgets in rows of equal cells, about as many columns as rows
+func gridLayout(panels []*sourcePanel) (*draw.Layout, error) {
+	cols := int(math.Ceil(math.Sqrt(float64(len(panels)))))
+	root := &dashboard.Node{}
+	for start := 0; start < len(panels); start += cols {
+		row := &dashboard.Node{}
+		for range min(cols, len(panels)-start) {
+			row.Col = append(row.Col, &dashboard.Node{})
+		}
+		root.Row = append(root.Row, row)
+	}
+	next := 0 // leaves are built in order, left to right and top to bottom
+	return dashboard.Build(root, func(*dashboard.Widget) (draw.Drawable, error) {
+		next++
+		return panels[next-1].widget(), nil
+	})
+}
+
+// widget returns the plot, sparklines or gauge
+func (m *sourcePanel) widget() draw.Drawable {
+	switch {
+	case m.gauge != nil:
+		return m.gauge
+	case m.sparklines != nil:
+		return m.sparklines
+	}
+	return m.plot
+}
+
+// base returns the widget's border and title
+func (m *sourcePanel) base() *draw.Base {
+	switch {
+	case m.gauge != nil:
+		return &m.gauge.Base
+	case m.sparklines != nil:
+		return &m.sparklines.Base
+	}
+	return &m.plot.Base
+}
+
+// defaultTitle is the user's title, or the source's description of what is graphed
+func (m *sourcePanel) defaultTitle() string {
+	if m.title != "" {
+		return m.title
+	}
+	return m.source.Title()
+}
+
+// update appends a batch to every line; errors are shown in the title (a multi-target source
+// still graphs the targets that answered), and so is a collection that is taking long.
+// Series seen for the first time get a new line (and legend entry) starting at this batch.
+func (m *sourcePanel) update(batch collector.Batch) {
+	base := m.base()
+	base.Lock()
+	defer base.Unlock()
+	if batch.Busy != "" {
+		// keep the data (and any error) up until the result arrives
+		if !strings.HasSuffix(base.Title, " | "+batch.Busy) {
+			base.Title += " | " + batch.Busy
+		}
+		return
+	}
+	base.Title = m.defaultTitle()
+	if batch.Err != nil {
+		log.Printf("%s: %v", m.source.Title(), batch.Err)
+		base.Title += " | Error: " + truncateError(batch.Err.Error())
+		if len(batch.Readings) == 0 {
+			return
+		}
+		// some targets failed: graph the others
+	} else if len(batch.Readings) == 0 {
+		base.Title += " | no matching series"
+	}
+
+	values := make([]float64, m.history.NumSeries())
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	for _, r := range batch.Readings {
+		i, ok := m.lines[r.Key]
+		if !ok {
+			i = m.history.AddSeries()
+			m.lines[r.Key] = i
+			m.series = append(m.series, r.Sample)
+			m.groups = append(m.groups, r.Group)
+			values = append(values, math.NaN())
+		}
+		values[i] = r.Value
+		m.series[i] = r.Sample
+	}
+	if m.history.NumSeries() == 0 {
+		return
+	}
+
+	m.history.Append(batch.Time, values)
+	if m.gauge != nil {
+		m.updateGauge(values)
+		return
+	}
+	if m.sparklines != nil {
+		m.updateSparklines()
+		return
+	}
+	m.plot.Data = m.history.Lines()
+	m.plot.XLabels = timeLabels(m.history.Times())
+	m.plot.DataLabels = m.legends()
+}
+
+// updateGauge shows the first series' latest value; the bar is the value clamped to 0-100
+func (m *sourcePanel) updateGauge(values []float64) {
+	v := values[0]
+	if math.IsNaN(v) {
+		m.gauge.Label = "no data"
+		m.gauge.Percent = 0
+		return
+	}
+	m.gauge.Percent = int(math.Round(math.Max(0, math.Min(100, v))))
+	m.gauge.Label = strconv.FormatFloat(v, 'g', 6, 64)
+	if len(values) > 1 {
+		// other series aren't shown; say which one this is
+		m.gauge.Label = m.legends()[0] + ": " + m.gauge.Label
+	}
+}
+
+// updateSparklines gives every series a sparkline titled with its legend and latest value,
+// showing as much of its history as fits (sparklines draw from the left). Missing values are
+// drawn as 0, as sparklines have no gaps.
+func (m *sourcePanel) updateSparklines() {
+	legends := m.legends()
+	width := m.sparklines.Inner.Dx()
+	for i := range legends {
+		if i == len(m.sparklines.Sparklines) {
+			sparkline := widgets.NewSparkline()
+			sparkline.LineColor = m.sparkColor
+			m.sparklines.Sparklines = append(m.sparklines.Sparklines, sparkline)
+		}
+		values := m.history.Series(i)
+		latest := "no data"
+		if v := values[len(values)-1]; !math.IsNaN(v) {
+			latest = strconv.FormatFloat(v, 'g', 6, 64)
+		}
+		if width > 0 && len(values) > width {
+			values = values[len(values)-width:]
+		}
+		data := make([]float64, len(values))
+		for j, v := range values {
+			if !math.IsNaN(v) {
+				data[j] = v
+			}
+		}
+		m.sparklines.Sparklines[i].Data = data
+		m.sparklines.Sparklines[i].Title = legends[i] + ": " + latest
+	}
+}
+
+// legends labels each line for the plot legend: a group with one series shows the group
+// itself (e.g. the selector), one that expanded shows the labels telling its series apart
+func (m *sourcePanel) legends() []string {
+	groups := map[string][]int{} // group => its lines
+	for i, group := range m.groups {
+		groups[group] = append(groups[group], i)
+	}
+	legends := make([]string, len(m.series))
+	for group, lines := range groups {
+		series := make([]collector.Sample, len(lines))
+		for j, i := range lines {
+			series[j] = m.series[i]
+		}
+		for j, legend := range collector.Legends(series, group) {
+			legends[lines[j]] = legend
+		}
+	}
+	return legends
+}
+
+// collectFirst starts the panels' sources and waits for one batch from each (for --snapshot);
+// sources that run out, like replays, are read to the end instead. Alert rules are checked after
+// every batch (after the last one of a backfill).
+func collectFirst(panels []*sourcePanel, alerts *alerter) {
+	if len(panels) == 0 {
+		return
+	}
+	batches := make(chan collector.Batch)
+	finished := make(chan struct{})
+	bySource := map[collector.Source]*sourcePanel{}
+	for _, p := range panels {
+		bySource[p.source] = p
+		p.source.Start(batches)
+		if finite, ok := p.source.(collector.Finite); ok {
+			go func() {
+				<-finite.Done()
+				finished <- struct{}{}
+			}()
+		}
+	}
+	for pending := len(panels); pending > 0; {
+		select {
+		case batch := <-batches:
+			bySource[batch.Source].update(batch)
+			if batch.Busy != "" || batch.More {
+				continue // still waiting for the (rest of the) result
+			}
+			alerts.check(bySource[batch.Source])
+			if _, ok := batch.Source.(collector.Finite); !ok {
+				batch.Source.Stop()
+				pending--
+			}
+		case <-finished:
+			pending--
+		}
+	}
+}
+
+// environment variables holding scrape credentials, so they stay out of shell history and ps
+const (
+	envBearerToken     = "CONSOLE_VIZ_BEARER_TOKEN"
+	envBearerTokenFile = "CONSOLE_VIZ_BEARER_TOKEN_FILE"
+	envBasicAuth       = "CONSOLE_VIZ_BASIC_AUTH"
+)
+
+// scrapeConfig builds the scraper settings from the flags, falling back to the environment for
+// credentials when no credential flag is given
+func scrapeConfig(config Config) (collector.ScrapeConfig, error) {
+	cfg := collector.ScrapeConfig{
+		Timeout:            config.ScrapeTimeout,
+		BearerToken:        config.BearerToken,
+		BearerTokenFile:    config.BearerTokenFile,
+		CAFile:             config.CAFile,
+		CertFile:           config.CertFile,
+		KeyFile:            config.KeyFile,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	basicAuth := config.BasicAuth
+	if cfg.BearerToken == "" && cfg.BearerTokenFile == "" && basicAuth == "" {
+		cfg.BearerToken = os.Getenv(envBearerToken)
+		cfg.BearerTokenFile = os.Getenv(envBearerTokenFile)
+		basicAuth = os.Getenv(envBasicAuth)
+	}
+	if basicAuth != "" {
+		user, password, ok := strings.Cut(basicAuth, ":")
+		if !ok || user == "" {
+			return cfg, fmt.Errorf("basic auth must be user:password")
+		}
+		cfg.Username, cfg.Password = user, password
+	}
+	return cfg, nil
+}
+
+// timeLabels labels each scrape on the x-axis by its age relative to the newest one
+// (-5m, -4m45s, ..., now), so the axis shows the time span the history covers
+func timeLabels(times []time.Time) []string {
+	labels := make([]string, len(times))
+	if len(times) == 0 {
+		return labels
+	}
+	newest := times[len(times)-1]
+	for i, t := range times {
+		labels[i] = formatAge(newest.Sub(t))
+	}
+	return labels
+}
+
+// formatAge formats a non-negative age compactly: now, -500ms, -45s, -2m, -2m30s, -1h5m
+func formatAge(d time.Duration) string {
+	if d < time.Second {
+		if d = d.Round(10 * time.Millisecond); d <= 0 {
+			return "now"
+		}
+		return "-" + d.String()
+	}
+	d = d.Round(time.Second)
+	if d >= time.Hour {
+		d = d.Round(time.Minute)
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return "-" + s
+}
+
+// parseHistory reads --history: a number of scrapes ("120") or a duration ("1h") that is
+// converted to scrapes at the given interval
+func parseHistory(s string, interval time.Duration) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return defaultHistory, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		d, err := collector.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("history %q: expected a number of scrapes or a duration like 30m", s)
+		}
+		if interval <= 0 {
+			interval = defaultInterval
+		}
+		n = int(d/interval) + 1
+	}
+	if n < 2 {
+		return 0, fmt.Errorf("history %q: keep at least 2 scrapes", s)
+	}
+	return n, nil
+}
+
+// parseSpeed reads --speed: a factor like "10x", "0.5x" or "2", or "max" (no pauses, returned as 0)
+func parseSpeed(s string) (float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "max" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || speed <= 0 || math.IsInf(speed, 0) {
+		return 0, fmt.Errorf("speed %q: expected a factor like 10x or max", s)
+	}
+	return speed, nil
+}
+
+// filePanel is a widget built from a data file that is reloaded on an interval
+type filePanel struct {
+	current    draw.Drawable
+	widgetType string
+	config     Config
+	colors     []styling.Color
+}
+
+func (f *filePanel) widget() draw.Drawable {
+	return f.current
+}
+
+// refresh reloads the file and rebuilds the widget; on error the old widget stays up
+func (f *filePanel) refresh() draw.Drawable {
+	data, err := loadFileData(f.config)
+	if err != nil {
+		log.Printf("reload %s: %v", f.config.DataFile, err)
+		return f.current
+	}
+	widget, err := createWidget(f.widgetType, data, f.config)
+	if err != nil {
+		log.Printf("reload %s: %v", f.config.DataFile, err)
+		return f.current
+	}
+	applyColors(widget, f.colors)
+	f.current = widget
+	return widget
+}
@@ -0,0 +1,163 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is a threshold alert on the lines a source reports, written like
+//
+//	windows_cpu_core_frequency_mhz < 1000 for 2m
+//	slow disk: rate(node_disk_io_time_seconds_total[1m]) > 0.9 for 5m
+//
+// A rule watches the series its selector matches, or, when it is a function like rate(...), the
+// lines of that same expression. It fires for a series once the comparison has held at every
+// scrape for at least For (right away when For is 0).
+type Rule struct {
+	Name      string        // "slow disk"; the rule text when not given
+	Expr      *Expr         // the series watched
+	Op        string        // <, <=, >, >=, == or !=
+	Threshold float64       // the value compared against
+	For       time.Duration // how long the comparison must hold before the rule fires
+	text      string
+}
+
+// ruleOps are the comparisons a rule can make, two-character ones first so "<=" isn't read as "<"
+var ruleOps = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// ParseRule parses "[name: ]expression op threshold [for duration]"
+func ParseRule(s string) (*Rule, error) {
+	text := strings.TrimSpace(s)
+	rule := &Rule{text: text}
+	at, op := ruleOp(text)
+	if at == -1 {
+		return nil, fmt.Errorf("rule %q: expected a comparison like metric < 1000", s)
+	}
+	rule.Op = op
+
+	left := text[:at]
+	if colon := strings.Index(left, ": "); colon != -1 && !strings.ContainsAny(left[:colon], "{(\"'") {
+		rule.Name = strings.TrimSpace(left[:colon])
+		left = left[colon+2:]
+		rule.text = strings.TrimSpace(text[colon+2:])
+	}
+	expr, err := ParseExpr(left)
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %w", s, err)
+	}
+	rule.Expr = expr
+
+	right := strings.Fields(text[at+len(op):])
+	if len(right) == 0 {
+		return nil, fmt.Errorf("rule %q: missing threshold after %s", s, op)
+	}
+	if rule.Threshold, err = strconv.ParseFloat(right[0], 64); err != nil {
+		return nil, fmt.Errorf("rule %q: invalid threshold %q", s, right[0])
+	}
+	switch {
+	case len(right) == 1:
+	case len(right) == 3 && strings.EqualFold(right[1], "for"):
+		if rule.For, err = ParseDuration(right[2]); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", s, err)
+		}
+	default:
+		return nil, fmt.Errorf("rule %q: expected \"for <duration>\" after the threshold", s)
+	}
+	if rule.Name == "" {
+		rule.Name = rule.text
+	}
+	return rule, nil
+}
+
+// ruleOp finds the comparison outside braces, parentheses and quotes (label matchers like != and
+// =~ live inside the braces), returning its index and text, or -1
+func ruleOp(s string) (int, string) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{' || c == '(' || c == '[':
+			depth++
+		case c == '}' || c == ')' || c == ']':
+			depth--
+		case depth == 0:
+			for _, op := range ruleOps {
+				if strings.HasPrefix(s[i:], op) {
+					return i, op
+				}
+			}
+		}
+	}
+	return -1, ""
+}
+
+// String returns the rule as written (without its name)
+func (r *Rule) String() string {
+	return r.text
+}
+
+// Matches reports whether the rule watches a line: one whose sample its selector matches, or
+// for a function, a line of the same expression (group is the line's Reading.Group)
+func (r *Rule) Matches(sample Sample, group string) bool {
+	if r.Expr.Func != "" {
+		return strings.Join(strings.Fields(group), "") == strings.Join(strings.Fields(r.Expr.Legend()), "")
+	}
+	if _, _, call := splitCall(group); call {
+		return false // the line is computed from the series (e.g. its rate), not the series itself
+	}
+	return r.Expr.Selector.Matches(sample)
+}
+
+// Holds reports whether a value satisfies the comparison; a missing value (NaN) never does
+func (r *Rule) Holds(v float64) bool {
+	if math.IsNaN(v) {
+		return false
+	}
+	switch r.Op {
+	case "<":
+		return v < r.Threshold
+	case "<=":
+		return v <= r.Threshold
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	case "==":
+		return v == r.Threshold
+	case "!=":
+		return v != r.Threshold
+	}
+	return false
+}
+
+// Since returns when the comparison started holding for one line's history (times and values
+// oldest first, as History keeps them) and has held at every scrape since; ok is false when it
+// doesn't hold at the newest scrape
+func (r *Rule) Since(times []time.Time, values []float64) (since time.Time, ok bool) {
+	for i := len(values) - 1; i >= 0 && i < len(times); i-- {
+		if !r.Holds(values[i]) {
+			break
+		}
+		since, ok = times[i], true
+	}
+	return since, ok
+}
+
+// Firing reports whether the rule fires for one line's history: the comparison has held for at
+// least For up to the newest scrape
+func (r *Rule) Firing(times []time.Time, values []float64) bool {
+	since, ok := r.Since(times, values)
+	return ok && times[len(times)-1].Sub(since) >= r.For
+}
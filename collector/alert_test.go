@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		text      string
+		name      string
+		expr      string
+		op        string
+		threshold float64
+		forDur    time.Duration
+	}{
+		{text: "windows_cpu_core_frequency_mhz < 1000 for 2m", name: "windows_cpu_core_frequency_mhz < 1000 for 2m",
+			expr: "windows_cpu_core_frequency_mhz", op: "<", threshold: 1000, forDur: 2 * time.Minute},
+		{text: "slow disk: rate(node_disk_io_time_seconds_total[1m]) > 0.9 for 5m", name: "slow disk",
+			expr: "rate(node_disk_io_time_seconds_total[1m])", op: ">", threshold: 0.9, forDur: 5 * time.Minute},
+		// != and : inside the braces belong to the selector
+		{text: `up{job!="a:b"} <= 0`, name: `up{job!="a:b"} <= 0`, expr: `up{job!="a:b"}`, op: "<=", threshold: 0},
+		{text: "memory >= 90 FOR 30s", name: "memory >= 90 FOR 30s", expr: "memory", op: ">=", threshold: 90, forDur: 30 * time.Second},
+		{text: "errors == 1e3", name: "errors == 1e3", expr: "errors", op: "==", threshold: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			rule, err := ParseRule(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule.Name != tt.name || rule.Expr.String() != tt.expr || rule.Op != tt.op || rule.Threshold != tt.threshold || rule.For != tt.forDur {
+				t.Errorf("ParseRule = %q %q %s %v for %s, want %q %q %s %v for %s",
+					rule.Name, rule.Expr, rule.Op, rule.Threshold, rule.For, tt.name, tt.expr, tt.op, tt.threshold, tt.forDur)
+			}
+		})
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, text := range []string{
+		"up",                    // no comparison
+		"up <",                  // no threshold
+		"up < high",             // threshold not a number
+		"up < 1 during 5m",      // not "for"
+		"up < 1 for",            // no duration
+		"up < 1 for soon",       // bad duration
+		"rate(up[1m) > 1",       // bad expression
+		"sum(up) > 1 for 1m",    // unknown function
+		`up{job="a" < 1 for 1m`, // unterminated matcher hides the comparison
+	} {
+		if _, err := ParseRule(text); err == nil {
+			t.Errorf("ParseRule(%q) = nil error", text)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	freq := Sample{Name: "cpu_mhz", Labels: map[string]string{"core": "0"}}
+	tests := []struct {
+		rule   string
+		sample Sample
+		group  string // the line's Reading.Group
+		want   bool
+	}{
+		{rule: "cpu_mhz < 1000", sample: freq, group: "cpu_mhz", want: true},
+		{rule: `cpu_mhz{core="1"} < 1000`, sample: freq, group: "cpu_mhz", want: false},
+		{rule: "memory > 90", sample: freq, group: "cpu_mhz", want: false},
+		// a selector doesn't watch lines computed from its series
+		{rule: "cpu_mhz < 1000", sample: freq, group: "rate(cpu_mhz[1m])", want: false},
+		// a function watches the lines of the same expression, however it is spaced
+		{rule: "rate(cpu_mhz[1m]) > 5", sample: freq, group: "rate( cpu_mhz[1m] )", want: true},
+		{rule: "rate(cpu_mhz[5m]) > 5", sample: freq, group: "rate(cpu_mhz[1m])", want: false},
+	}
+	for _, tt := range tests {
+		rule, err := ParseRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rule.Matches(tt.sample, tt.group); got != tt.want {
+			t.Errorf("%q Matches(%s, %q) = %v, want %v", tt.rule, tt.sample, tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestRuleHolds(t *testing.T) {
+	tests := []struct {
+		op   string
+		v    float64
+		want bool
+	}{
+		{"<", 9, true}, {"<", 10, false},
+		{"<=", 10, true}, {"<=", 11, false},
+		{">", 11, true}, {">", 10, false},
+		{">=", 10, true}, {">=", 9, false},
+		{"==", 10, true}, {"==", 9, false},
+		{"!=", 9, true}, {"!=", 10, false},
+		{"!=", math.NaN(), false}, // a missing value never holds
+		{"<", math.Inf(-1), true},
+	}
+	for _, tt := range tests {
+		rule, err := ParseRule("x " + tt.op + " 10")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rule.Holds(tt.v); got != tt.want {
+			t.Errorf("x %s 10 Holds(%v) = %v, want %v", tt.op, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestRuleFiring(t *testing.T) {
+	nan := math.NaN()
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		rule     string
+		values   []float64 // one scrape every 30s, oldest first
+		capacity int       // history kept; 0 keeps every value
+		since    int       // index of the scrape the comparison has held since; -1 when it doesn't hold now
+		firing   bool
+	}{
+		{name: "held long enough", rule: "mhz < 1000 for 1m", values: []float64{1200, 900, 800, 700}, since: 1, firing: true},
+		{name: "not yet", rule: "mhz < 1000 for 1m", values: []float64{1200, 1100, 800, 700}, since: 2, firing: false},
+		{name: "exactly for", rule: "mhz < 1000 for 1m", values: []float64{1200, 800, 800, 800}, since: 1, firing: true},
+		{name: "recovered", rule: "mhz < 1000 for 1m", values: []float64{800, 800, 800, 1200}, since: -1, firing: false},
+		{name: "interrupted", rule: "mhz < 1000 for 1m", values: []float64{800, 800, 1200, 800}, since: 3, firing: false},
+		{name: "missing scrape starts over", rule: "mhz < 1000 for 1m", values: []float64{800, 800, nan, 800, 800}, since: 3, firing: false},
+		{name: "no for fires right away", rule: "mhz < 1000", values: []float64{1200, 800}, since: 1, firing: true},
+		{name: "single scrape", rule: "mhz < 1000", values: []float64{800}, since: 0, firing: true},
+		// the history keeps 3 scrapes (1m), so a 2m rule can't see that it held that long
+		{name: "for longer than the history", rule: "mhz < 1000 for 2m", values: []float64{800, 800, 800, 800, 800, 800}, capacity: 3, since: 3, firing: false},
+		{name: "for within the history", rule: "mhz < 1000 for 1m", values: []float64{800, 800, 800, 800, 800, 800}, capacity: 3, since: 3, firing: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			capacity := tt.capacity
+			if capacity == 0 {
+				capacity = len(tt.values)
+			}
+			history := NewHistory(capacity)
+			line := history.AddSeries()
+			for i, v := range tt.values {
+				history.Append(t0.Add(time.Duration(i)*30*time.Second), []float64{v})
+			}
+			times, values := history.Times(), history.Series(line)
+
+			since, ok := rule.Since(times, values)
+			if tt.since == -1 {
+				if ok {
+					t.Errorf("Since = %v, want not holding", since)
+				}
+			} else if want := t0.Add(time.Duration(tt.since) * 30 * time.Second); !ok || !since.Equal(want) {
+				t.Errorf("Since = %v, %v; want %v", since, ok, want)
+			}
+			if got := rule.Firing(times, values); got != tt.firing {
+				t.Errorf("Firing = %v, want %v", got, tt.firing)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Evaluator computes --metric expressions across consecutive scrapes. Plain selectors pass their
+// values through; rate, irate, increase and delta keep each series' recent samples and replace
+// its value with the function over them, using the real time between scrapes (the samples'
+// own timestamps when the exporter sets them, else GenericSnapshot.Time).
+// A series has no value (NaN) until it has been seen in two scrapes.
+type Evaluator struct {
+	exprs   []*Expr
+	windows map[string][]timedValue // SeriesSample.Key() => samples within the expression's window
+}
+
+// timedValue is one scrape of a series
+type timedValue struct {
+	t time.Time
+	v float64
+}
+
+// NewEvaluator parses the expressions (same order as the selectors given to FetchGenericMetrics)
+func NewEvaluator(exprs []string) (*Evaluator, error) {
+	e := &Evaluator{exprs: make([]*Expr, len(exprs)), windows: map[string][]timedValue{}}
+	for i, s := range exprs {
+		expr, err := ParseExpr(s)
+		if err != nil {
+			return nil, err
+		}
+		e.exprs[i] = expr
+	}
+	return e, nil
+}
+
+// Apply replaces the raw values in snapshot with each expression's result for this scrape.
+// histogram_quantile folds each group of _bucket series (same labels apart from le) into one
+// series named after the histogram, so Series can get shorter.
+func (e *Evaluator) Apply(snapshot *GenericSnapshot) {
+	seen := map[string]bool{}
+	var out []SeriesSample
+	histograms := map[string]*histogram{} // selector + series without le => its buckets
+	for _, series := range snapshot.Series {
+		if series.Selector >= len(e.exprs) {
+			out = append(out, series)
+			continue
+		}
+		expr := e.exprs[series.Selector]
+		rangeExpr := expr
+		if expr.Func == "histogram_quantile" {
+			rangeExpr = expr.Arg
+		}
+		if rangeExpr.Func != "" {
+			key := series.Key()
+			seen[key] = true
+			t := series.Timestamp
+			if t.IsZero() {
+				t = snapshot.Time
+			}
+			series.Value = e.observe(key, rangeExpr, timedValue{t, series.Value})
+		}
+		if expr.Func != "histogram_quantile" {
+			out = append(out, series)
+			continue
+		}
+		b, ok := parseBucket(series.Sample)
+		if !ok {
+			continue // not a bucket (e.g. the selector also matched _sum); skip it
+		}
+		key := strconv.Itoa(series.Selector) + " " + b.key
+		h, ok := histograms[key]
+		if !ok {
+			// the quantile takes the place of the histogram's first bucket
+			h = &histogram{slot: len(out), series: SeriesSample{Selector: series.Selector, Sample: b.series}}
+			histograms[key] = h
+			out = append(out, h.series)
+		}
+		h.buckets = append(h.buckets, b)
+	}
+	for _, h := range histograms {
+		h.series.Value = bucketQuantile(e.exprs[h.series.Selector].Quantile, h.buckets)
+		out[h.slot] = h.series
+	}
+	snapshot.Series = out
+
+	first := map[int]bool{}
+	for _, series := range snapshot.Series {
+		if !first[series.Selector] && series.Selector < len(snapshot.Values) {
+			first[series.Selector] = true
+			snapshot.Values[series.Selector] = series.Value
+		}
+	}
+	// series that disappeared from the page start over if they come back
+	for key := range e.windows {
+		if !seen[key] {
+			delete(e.windows, key)
+		}
+	}
+}
+
+// Legend returns the short name for lines of the i-th expression (see Expr.Legend)
+func (e *Evaluator) Legend(i int) string {
+	if i < 0 || i >= len(e.exprs) {
+		return ""
+	}
+	return e.exprs[i].Legend()
+}
+
+// observe records a sample of a series and returns the expression's value over its window
+func (e *Evaluator) observe(key string, expr *Expr, tv timedValue) float64 {
+	window := e.windows[key]
+	if n := len(window); n > 0 && !tv.t.After(window[n-1].t) {
+		// same sample scraped again (the exporter's timestamp didn't move): nothing new
+		return evaluate(expr.Func, window)
+	}
+	window = append(window, tv)
+	// keep the samples within the range, and always the last two so a range shorter than the
+	// scrape interval still has something to compare
+	if expr.Func == "irate" || expr.Window == 0 {
+		if len(window) > 2 {
+			window = window[len(window)-2:]
+		}
+	} else {
+		start := tv.t.Add(-expr.Window)
+		drop := 0
+		for drop < len(window)-2 && window[drop].t.Before(start) {
+			drop++
+		}
+		window = window[drop:]
+	}
+	e.windows[key] = window
+	return evaluate(expr.Func, window)
+}
+
+// evaluate applies a range function to a series' samples (oldest first)
+func evaluate(fn string, window []timedValue) float64 {
+	if len(window) < 2 {
+		return math.NaN()
+	}
+	first, last := window[0], window[len(window)-1]
+	if fn == "delta" {
+		return last.v - first.v
+	}
+	if fn == "irate" {
+		first = window[len(window)-2]
+		window = window[len(window)-2:]
+	}
+	increase := 0.0
+	for i := 1; i < len(window); i++ {
+		prev, cur := window[i-1].v, window[i].v
+		if cur < prev {
+			// counter reset (e.g. exporter restart): it counted up from zero to cur
+			increase += cur
+		} else {
+			increase += cur - prev
+		}
+	}
+	if fn == "increase" {
+		return increase
+	}
+	elapsed := last.t.Sub(first.t).Seconds()
+	if elapsed <= 0 {
+		return math.NaN()
+	}
+	return increase / elapsed
+}
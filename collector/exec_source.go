@@ -0,0 +1,225 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterSource("exec", newExecSource)
+}
+
+// newExecSource runs a shell command every interval and reads numbers from its stdout
+// (see ParseCommandOutput). A run that exits non-zero or outlives the timeout (the interval when
+// not set) becomes a batch error.
+func newExecSource(cfg SourceConfig) (Source, error) {
+	if strings.TrimSpace(cfg.Command) == "" {
+		return nil, fmt.Errorf("exec source: no command")
+	}
+	var pattern *regexp.Regexp
+	if cfg.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(cfg.Pattern); err != nil {
+			return nil, fmt.Errorf("exec pattern: %w", err)
+		}
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = cfg.Interval
+	}
+	p := newPoller(cfg.Command, cfg.Interval, func(ctx context.Context) Batch {
+		now := time.Now()
+		out, err := runCommand(ctx, cfg.Command, timeout)
+		if err != nil {
+			return Batch{Time: now, Err: err}
+		}
+		samples := ParseCommandOutput(out, pattern)
+		batch := Batch{Time: now, Readings: make([]Reading, len(samples))}
+		for i, sample := range samples {
+			batch.Readings[i] = Reading{Key: sample.Name, Group: cfg.Command, Sample: sample}
+		}
+		return batch
+	})
+	p.busy = "running…"
+	return p, nil
+}
+
+// runCommand runs command through the shell and returns its stdout; a non-zero exit is reported
+// with the first line of stderr, and a run killed by its timeout or by Stop says so
+func runCommand(ctx context.Context, command string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.CommandContext(ctx, shell, flag, command)
+	// children that outlive a killed shell keep the pipes open; don't wait on them forever
+	cmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	// a killed command only says "signal: killed"; say why it was killed instead
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return "", fmt.Errorf("timed out after %s", timeout)
+	case context.Canceled:
+		return "", errors.New("cancelled")
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		msg := fmt.Sprintf("exit status %d", exitErr.ExitCode())
+		if line, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); line != "" {
+			msg += ": " + line
+		}
+		return "", errors.New(msg)
+	}
+	if err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// numberToken is a number with an optional unit suffix (73%, 12ms, 1.5e3, -4)
+var numberToken = regexp.MustCompile(`^[-+]?(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][-+]?\d+)?[A-Za-z%/]*$`)
+
+// numberPrefix is the numeric part of a numberToken
+var numberPrefix = regexp.MustCompile(`^[-+]?(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][-+]?\d+)?`)
+
+// ParseCommandOutput pulls named numbers out of a command's output. With a pattern, every match
+// is one sample: the groups named "name" (or "key") and "value" are used when present, otherwise
+// two groups are name and value, one group is the value, and no groups means the whole match.
+// Without a pattern each line is read on its own:
+//
+//	key: value  /  key=value   => sample "key"
+//	eth0 1234                  => sample "eth0" (first word, then the first number after it)
+//	73%                        => unnamed value
+//
+// A key starts with a letter and may be several words ("load average: 0.52"); a ":" in a time
+// (10:00:01) doesn't make one, nor does a first word starting with a digit. Values may carry a unit suffix (73%, 12ms), which is dropped; lines without a number (e.g.
+// headers) are skipped. Unnamed values are called value, value2, value3, ... in output order.
+func ParseCommandOutput(output string, pattern *regexp.Regexp) []Sample {
+	var samples []Sample
+	seen := map[string]bool{}
+	unnamed := 0
+	add := func(name, text string) {
+		value, ok := firstNumber(text)
+		if !ok {
+			return
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			unnamed++
+			name = "value"
+			if unnamed > 1 {
+				name += strconv.Itoa(unnamed)
+			}
+		}
+		if seen[name] {
+			return // the first occurrence wins
+		}
+		seen[name] = true
+		samples = append(samples, Sample{Name: name, Value: value})
+	}
+
+	if pattern != nil {
+		nameGroup, valueGroup := -1, -1
+		for i, group := range pattern.SubexpNames() {
+			switch group {
+			case "name", "key":
+				nameGroup = i
+			case "value":
+				valueGroup = i
+			}
+		}
+		groups := pattern.NumSubexp()
+		for _, m := range pattern.FindAllStringSubmatch(output, -1) {
+			switch {
+			case valueGroup != -1:
+				name := ""
+				if nameGroup != -1 {
+					name = m[nameGroup]
+				}
+				add(name, m[valueGroup])
+			case groups >= 2:
+				add(m[1], m[2])
+			case groups == 1:
+				add("", m[1])
+			default:
+				add("", m[0])
+			}
+		}
+		return samples
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if key, value, ok := cutKey(line); ok {
+			add(key, value)
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 1 && !numberToken.MatchString(fields[0]) && !startsWithDigit(fields[0]) {
+			add(fields[0], strings.Join(fields[1:], " "))
+			continue
+		}
+		add("", line)
+	}
+	return samples
+}
+
+// keyName is what a key before ":" or "=" looks like: words starting with a letter (load
+// average, eth0.rx_bytes, cpu-temp), not a time or a count (10:00:01, 2:03, 1 user)
+var keyName = regexp.MustCompile(`^[A-Za-z_][\w.\-/]*(?:\s+[A-Za-z_][\w.\-/]*)*$`)
+
+// cutKey splits a "key: value" or "key=value" line at the first ":" or "=" that follows a key,
+// which runs back to the start of the line or to the last "," or ";" before it. In uptime's
+// " 10:00:01 up 3 days, 2:03, 1 user, load average: 0.52, 0.58" that is "load average".
+func cutKey(line string) (key, value string, ok bool) {
+	for i, r := range line {
+		if r != ':' && r != '=' {
+			continue
+		}
+		key = line[:i]
+		if j := strings.LastIndexAny(key, ",;"); j >= 0 {
+			key = key[j+1:]
+		}
+		if key = strings.TrimSpace(key); keyName.MatchString(key) {
+			return key, line[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// startsWithDigit reports whether a word is a time, date or the like (10:00:01, 2024-05-01)
+func startsWithDigit(word string) bool {
+	return word != "" && word[0] >= '0' && word[0] <= '9'
+}
+
+// firstNumber returns the first whitespace-separated token of s that is a number (ignoring a
+// unit suffix and trailing punctuation like the commas in "0.52, 0.58")
+func firstNumber(s string) (float64, bool) {
+	for _, field := range strings.Fields(s) {
+		field = strings.TrimRight(field, ",;")
+		if !numberToken.MatchString(field) {
+			continue
+		}
+		v, err := strconv.ParseFloat(numberPrefix.FindString(field), 64)
+		if err == nil {
+			return v, true
+		}
+	}
+	return 0, false
+}
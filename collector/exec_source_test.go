@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestParseCommandOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		pattern string
+		want    string // samples as name=value, in order
+	}{
+		{name: "key colon value", output: "Temperature: 45.5 C\nFan: 1200 rpm\n", want: "Temperature=45.5 Fan=1200"},
+		{name: "key equals value", output: "rx_bytes=1024\ntx-bytes = 2048\n", want: "rx_bytes=1024 tx-bytes=2048"},
+		{name: "several-word key", output: "Mem total: 16384 kB\n", want: "Mem total=16384"},
+		{
+			name:   "uptime",
+			output: " 10:00:01 up 3 days,  2:03,  1 user,  load average: 0.52, 0.58, 0.59\n",
+			want:   "load average=0.52",
+		},
+		{name: "time without a key", output: "10:00:01 up 3 days\n", want: "value=3"},
+		{name: "date first", output: "2024-05-01 42 jobs\n", want: "value=42"},
+		{name: "word then number", output: "eth0 1234 5678\nlo 99\n", want: "eth0=1234 lo=99"},
+		{name: "bare values", output: "73%\n12ms\n", want: "value=73 value2=12"},
+		{name: "header skipped", output: "Filesystem Use%\n/dev/sda1 45%\n", want: "/dev/sda1=45"},
+		{name: "first occurrence wins", output: "a: 1\na: 2\n", want: "a=1"},
+		{name: "value not a number", output: "status: ok\nurl: http://host:80\n", want: ""},
+		{name: "named groups", output: "x=1 y=2", pattern: `(?P<key>\w)=(?P<value>\d)`, want: "x=1 y=2"},
+		{name: "two groups", output: "cpu 5, mem 7", pattern: `(\w+) (\d+)`, want: "cpu=5 mem=7"},
+		{name: "one group", output: "took 12ms", pattern: `took (\S+)`, want: "value=12"},
+		{name: "whole match", output: "load 0.5 1.5", pattern: `\d\.\d`, want: "value=0.5 value2=1.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pattern *regexp.Regexp
+			if tt.pattern != "" {
+				pattern = regexp.MustCompile(tt.pattern)
+			}
+			got := ""
+			for i, s := range ParseCommandOutput(tt.output, pattern) {
+				if i > 0 {
+					got += " "
+				}
+				got += fmt.Sprintf("%s=%g", s.Name, s.Value)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCommandOutput = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
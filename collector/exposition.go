@@ -0,0 +1,361 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricType is the declared type of a metric family (from its # TYPE line)
+type MetricType string
+
+const (
+	MetricUntyped   MetricType = "untyped"
+	MetricCounter   MetricType = "counter"
+	MetricGauge     MetricType = "gauge"
+	MetricHistogram MetricType = "histogram"
+	MetricSummary   MetricType = "summary"
+)
+
+// MetricFamily is the # TYPE / # HELP metadata of a metric family
+type MetricFamily struct {
+	Name string
+	Type MetricType
+	Help string
+}
+
+// Sample is one parsed exposition line: name{labels} value [timestamp]
+type Sample struct {
+	Name      string
+	Labels    map[string]string
+	Value     float64   // may be NaN or ±Inf
+	Timestamp time.Time // zero when the line has no timestamp
+}
+
+// String formats the sample's series the way it appears in the exposition, labels sorted by name
+// (e.g. windows_cpu_time_total{core="0,0",mode="idle"})
+func (s Sample) String() string {
+	return FormatSeries(s.Name, s.Labels)
+}
+
+// FormatSeries formats a metric name and labels as name{a="1",b="2"} (sorted, values escaped)
+func FormatSeries(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + strconv.Quote(labels[k])
+	}
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
+
+// Exposition is one parsed scrape: every sample in page order plus the family metadata
+type Exposition struct {
+	Samples  []Sample
+	Families map[string]*MetricFamily // by family name (from # TYPE and # HELP lines)
+}
+
+// familySuffixes are the sample-name suffixes that belong to a family of another name
+// (histogram/summary parts, OpenMetrics counter _total and _created)
+var familySuffixes = []string{"_bucket", "_sum", "_count", "_total", "_created"}
+
+// Family returns the metadata for the family a sample name belongs to (e.g. the "http_duration_seconds"
+// histogram for "http_duration_seconds_bucket"), or nil when the page declared none
+func (e *Exposition) Family(sampleName string) *MetricFamily {
+	if f, ok := e.Families[sampleName]; ok {
+		return f
+	}
+	for _, suffix := range familySuffixes {
+		if strings.HasSuffix(sampleName, suffix) {
+			if f, ok := e.Families[strings.TrimSuffix(sampleName, suffix)]; ok {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// TypeOf returns the declared type of a sample's family (untyped when not declared)
+func (e *Exposition) TypeOf(sampleName string) MetricType {
+	if f := e.Family(sampleName); f != nil && f.Type != "" {
+		return f.Type
+	}
+	return MetricUntyped
+}
+
+// ParseExposition parses the Prometheus text exposition format (and the OpenMetrics text format:
+// # EOF, # UNIT and exemplars are accepted and ignored). Label order, escaped quotes, whitespace
+// between tokens, NaN/+Inf/-Inf values and optional timestamps are all handled.
+// contentType is the page's Content-Type, which decides the timestamp unit: seconds for
+// application/openmetrics-text, milliseconds for the Prometheus text format (and "" or anything else).
+func ParseExposition(r io.Reader, contentType string) (*Exposition, error) {
+	openMetrics := IsOpenMetrics(contentType)
+	exp := &Exposition{Families: map[string]*MetricFamily{}}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			exp.parseComment(line)
+			continue
+		}
+		sample, err := parseSampleLine(line, openMetrics)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		exp.Samples = append(exp.Samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// IsOpenMetrics reports whether a Content-Type is the OpenMetrics text format
+func IsOpenMetrics(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/openmetrics-text"
+}
+
+// parseComment records # HELP and # TYPE metadata; other comments are ignored
+func (e *Exposition) parseComment(line string) {
+	fields := strings.Fields(strings.TrimPrefix(line, "#"))
+	if len(fields) < 2 {
+		return
+	}
+	kind, name := fields[0], fields[1]
+	if kind != "HELP" && kind != "TYPE" {
+		return
+	}
+	f, ok := e.Families[name]
+	if !ok {
+		f = &MetricFamily{Name: name, Type: MetricUntyped}
+		e.Families[name] = f
+	}
+	if kind == "TYPE" {
+		if len(fields) >= 3 {
+			f.Type = MetricType(strings.ToLower(fields[2]))
+		}
+		return
+	}
+	// help text is everything after the name, with \\ and \n escapes
+	rest := strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(line, "#")), "HELP")
+	rest = strings.TrimPrefix(strings.TrimSpace(rest), name)
+	f.Help = unescape(strings.TrimSpace(rest), false)
+}
+
+// parseSampleLine parses: name [{label="value",...}] value [timestamp] [# exemplar]
+// (the timestamp in OpenMetrics seconds or Prometheus milliseconds)
+func parseSampleLine(line string, openMetrics bool) (Sample, error) {
+	p := &lineParser{src: line}
+	name := p.name()
+	if name == "" {
+		return Sample{}, fmt.Errorf("expected metric name: %q", line)
+	}
+	sample := Sample{Name: name}
+
+	p.skipSpace()
+	if p.peek() == '{' {
+		labels, err := p.labels()
+		if err != nil {
+			return Sample{}, fmt.Errorf("%w: %q", err, line)
+		}
+		sample.Labels = labels
+	}
+
+	rest := strings.Fields(p.src[p.pos:])
+	// OpenMetrics exemplars follow " # "
+	for i, f := range rest {
+		if f == "#" {
+			rest = rest[:i]
+			break
+		}
+	}
+	if len(rest) == 0 || len(rest) > 2 {
+		return Sample{}, fmt.Errorf("expected value [timestamp] after series: %q", line)
+	}
+	value, err := ParseValue(rest[0])
+	if err != nil {
+		return Sample{}, fmt.Errorf("%w: %q", err, line)
+	}
+	sample.Value = value
+	if len(rest) == 2 {
+		ts, err := parseTimestamp(rest[1], openMetrics)
+		if err != nil {
+			return Sample{}, fmt.Errorf("%w: %q", err, line)
+		}
+		sample.Timestamp = ts
+	}
+	return sample, nil
+}
+
+// ParseValue parses a sample value, including NaN, +Inf, -Inf and Inf
+func ParseValue(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "nan":
+		return math.NaN(), nil
+	case "+inf", "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// parseTimestamp reads OpenMetrics seconds (1700000000 or 1700000000.123) or Prometheus
+// milliseconds (1700000000123)
+func parseTimestamp(s string, openMetrics bool) (time.Time, error) {
+	if !openMetrics {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+		}
+		return time.UnixMilli(ms), nil
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return time.Unix(0, int64(math.Round(secs*float64(time.Second)))), nil
+}
+
+// lineParser walks one sample line (or a selector with the same syntax)
+type lineParser struct {
+	src string
+	pos int
+}
+
+func (p *lineParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the current byte (0 at the end)
+func (p *lineParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// name reads a metric or label name: [a-zA-Z_:][a-zA-Z0-9_:]*
+func (p *lineParser) name() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		isLetter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':'
+		if !isLetter && !(p.pos > start && c >= '0' && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// labels reads {name="value", ...} (a trailing comma is allowed)
+func (p *lineParser) labels() (map[string]string, error) {
+	p.pos++ // {
+	labels := map[string]string{}
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			return labels, nil
+		}
+		name := p.name()
+		if name == "" {
+			return nil, fmt.Errorf("expected label name at offset %d", p.pos)
+		}
+		p.skipSpace()
+		if p.peek() != '=' {
+			return nil, fmt.Errorf("expected = after label %s", name)
+		}
+		p.pos++
+		p.skipSpace()
+		value, err := p.quoted()
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %w", name, err)
+		}
+		labels[name] = value
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		default:
+			return nil, fmt.Errorf("expected , or } after label %s", name)
+		}
+	}
+}
+
+// quoted reads a double-quoted label value with \\, \" and \n escapes
+func (p *lineParser) quoted() (string, error) {
+	if p.peek() != '"' {
+		return "", fmt.Errorf("expected quoted value at offset %d", p.pos)
+	}
+	p.pos++
+	start := p.pos
+	escaped := false
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			value := unescape(p.src[start:p.pos], true)
+			p.pos++
+			return value, nil
+		}
+		p.pos++
+	}
+	return "", fmt.Errorf("unterminated quoted value")
+}
+
+// unescape resolves \\ and \n (and \" inside label values)
+func unescape(s string, quotes bool) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch {
+		case s[i] == 'n':
+			b.WriteByte('\n')
+		case s[i] == '\\', s[i] == '"' && quotes:
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
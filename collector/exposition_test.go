@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExposition(t *testing.T) {
+	const prometheusText = "text/plain; version=0.0.4; charset=utf-8"
+	const openMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+	tests := []struct {
+		name        string
+		contentType string
+		page        string
+		want        []Sample
+		wantType    map[string]MetricType
+	}{
+		{
+			name:        "prometheus text",
+			contentType: prometheusText,
+			page: `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 1027 1700000000123
+http_requests_total{code="500", method="post"}   3
+`,
+			want: []Sample{
+				{Name: "http_requests_total", Labels: map[string]string{"method": "get", "code": "200"}, Value: 1027, Timestamp: time.UnixMilli(1700000000123)},
+				{Name: "http_requests_total", Labels: map[string]string{"method": "post", "code": "500"}, Value: 3},
+			},
+			wantType: map[string]MetricType{"http_requests_total": MetricCounter},
+		},
+		{
+			name:        "openmetrics",
+			contentType: openMetrics,
+			page: `# TYPE rpc_duration_seconds histogram
+# UNIT rpc_duration_seconds seconds
+rpc_duration_seconds_bucket{le="0.1"} 8 1700000000 # {trace_id="abc"} 0.05 1700000000.1
+rpc_duration_seconds_bucket{le="+Inf"} 10 1700000000.5
+rpc_duration_seconds_count 10
+# EOF
+`,
+			want: []Sample{
+				{Name: "rpc_duration_seconds_bucket", Labels: map[string]string{"le": "0.1"}, Value: 8, Timestamp: time.Unix(1700000000, 0)},
+				{Name: "rpc_duration_seconds_bucket", Labels: map[string]string{"le": "+Inf"}, Value: 10, Timestamp: time.Unix(1700000000, 5e8)},
+				{Name: "rpc_duration_seconds_count", Value: 10},
+			},
+			wantType: map[string]MetricType{"rpc_duration_seconds_bucket": MetricHistogram, "rpc_duration_seconds_count": MetricHistogram},
+		},
+		{
+			name: "unknown content type reads milliseconds",
+			page: "up 1 1700000000000\n",
+			want: []Sample{{Name: "up", Value: 1, Timestamp: time.UnixMilli(1700000000000)}},
+		},
+		{
+			name:        "escapes and special values",
+			contentType: prometheusText,
+			page: `msg{text="say \"hi\"\\n"} NaN
+temp{room="a"} +Inf
+temp{room="b"} -Inf
+`,
+			want: []Sample{
+				{Name: "msg", Labels: map[string]string{"text": `say "hi"\n`}, Value: math.NaN()},
+				{Name: "temp", Labels: map[string]string{"room": "a"}, Value: math.Inf(1)},
+				{Name: "temp", Labels: map[string]string{"room": "b"}, Value: math.Inf(-1)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp, err := ParseExposition(strings.NewReader(tt.page), tt.contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(exp.Samples) != len(tt.want) {
+				t.Fatalf("got %d samples, want %d: %+v", len(exp.Samples), len(tt.want), exp.Samples)
+			}
+			for i, got := range exp.Samples {
+				want := tt.want[i]
+				if got.String() != want.String() || !sameValue(got.Value, want.Value) || !got.Timestamp.Equal(want.Timestamp) {
+					t.Errorf("sample %d = %s %v @%v, want %s %v @%v", i, got, got.Value, got.Timestamp, want, want.Value, want.Timestamp)
+				}
+			}
+			for name, typ := range tt.wantType {
+				if got := exp.TypeOf(name); got != typ {
+					t.Errorf("TypeOf(%s) = %s, want %s", name, got, typ)
+				}
+			}
+		})
+	}
+}
+
+func TestParseExpositionErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		page        string
+	}{
+		{name: "no value", page: "up\n"},
+		{name: "unterminated labels", page: `up{job="a" 1` + "\n"},
+		{name: "bad value", page: "up one\n"},
+		{name: "fractional milliseconds", page: "up 1 1700000000.5\n"},
+		{name: "bad openmetrics timestamp", contentType: "application/openmetrics-text", page: "up 1 soon\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseExposition(strings.NewReader(tt.page), tt.contentType); err == nil {
+				t.Errorf("expected an error for %q", tt.page)
+			}
+		})
+	}
+}
+
+// sameValue compares sample values, NaN equal to NaN
+func sameValue(a, b float64) bool {
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
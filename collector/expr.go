@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is a parsed --metric expression: a series selector, optionally wrapped in a function that
+// is computed across consecutive scrapes, e.g. rate(http_requests_total{code="200"}[1m]), or
+// histogram_quantile(0.99, <selector or range function over _bucket series>)
+type Expr struct {
+	Func     string        // "" for a plain selector, histogram_quantile, or one of rangeFuncs
+	Window   time.Duration // [1m] range; 0 means "since the previous scrape"
+	Selector *Selector     // the series the expression reads (for histogram_quantile, Arg's)
+	Quantile float64       // histogram_quantile's φ
+	Arg      *Expr         // histogram_quantile's bucket expression
+	text     string
+}
+
+// rangeFuncs are the functions computed from a series' recent samples:
+//
+//	rate      per-second increase over the window, counter resets handled
+//	irate     per-second increase between the last two scrapes, counter resets handled
+//	increase  total increase over the window, counter resets handled
+//	delta     last minus first value over the window (for gauges; no reset handling)
+var rangeFuncs = map[string]bool{"rate": true, "irate": true, "increase": true, "delta": true}
+
+// ParseExpr parses selector, func(selector), func(selector[window]) or histogram_quantile(φ, expr)
+func ParseExpr(s string) (*Expr, error) {
+	text := strings.TrimSpace(s)
+	expr := &Expr{text: text}
+
+	name, inner, ok := splitCall(text)
+	if !ok {
+		sel, err := ParseSelector(text)
+		if err != nil {
+			return nil, err
+		}
+		expr.Selector = sel
+		return expr, nil
+	}
+	if name == "histogram_quantile" {
+		return parseQuantile(expr, inner)
+	}
+	if !rangeFuncs[name] {
+		return nil, fmt.Errorf("expression %q: unknown function %s (use rate, irate, increase, delta or histogram_quantile)", s, name)
+	}
+	expr.Func = name
+
+	if open := rangeStart(inner); open != -1 {
+		window, err := ParseDuration(inner[open+1 : len(inner)-1])
+		if err != nil {
+			return nil, fmt.Errorf("expression %q: %w", s, err)
+		}
+		expr.Window = window
+		inner = inner[:open]
+	}
+	sel, err := ParseSelector(inner)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", s, err)
+	}
+	expr.Selector = sel
+	return expr, nil
+}
+
+// parseQuantile parses the arguments of histogram_quantile(φ, expr); expr must select _bucket
+// series, either directly or through a range function such as rate(x_bucket[5m])
+func parseQuantile(expr *Expr, args string) (*Expr, error) {
+	phi, rest, ok := strings.Cut(args, ",")
+	if !ok {
+		return nil, fmt.Errorf("expression %q: histogram_quantile takes (quantile, buckets)", expr.text)
+	}
+	q, err := strconv.ParseFloat(strings.TrimSpace(phi), 64)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: invalid quantile %q", expr.text, strings.TrimSpace(phi))
+	}
+	arg, err := ParseExpr(rest)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", expr.text, err)
+	}
+	if arg.Func == "histogram_quantile" {
+		return nil, fmt.Errorf("expression %q: histogram_quantile can't be nested", expr.text)
+	}
+	if name := arg.Selector.Name; name != "" && !strings.HasSuffix(name, "_bucket") {
+		return nil, fmt.Errorf("expression %q: histogram_quantile needs _bucket series (did you mean %s_bucket?)", expr.text, name)
+	}
+	expr.Func = "histogram_quantile"
+	expr.Quantile = q
+	expr.Arg = arg
+	expr.Selector = arg.Selector
+	return expr, nil
+}
+
+// Legend is a short name for the expression's lines when nothing else tells them apart:
+// p99 http_request_duration_seconds for a quantile, the expression itself otherwise
+func (e *Expr) Legend() string {
+	if e.Func != "histogram_quantile" {
+		return e.text
+	}
+	legend := "p" + formatQuantile(e.Quantile)
+	if name := strings.TrimSuffix(e.Selector.Name, "_bucket"); name != "" {
+		legend += " " + name
+	}
+	return legend
+}
+
+// String returns the expression as written
+func (e *Expr) String() string {
+	return e.text
+}
+
+// splitCall splits name(args) into its function name and argument text
+func splitCall(s string) (name, args string, ok bool) {
+	open := strings.Index(s, "(")
+	if open <= 0 || !strings.HasSuffix(s, ")") {
+		return "", "", false
+	}
+	name = strings.TrimSpace(s[:open])
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c == '_') {
+			return "", "", false
+		}
+	}
+	return strings.ToLower(name), strings.TrimSpace(s[open+1 : len(s)-1]), true
+}
+
+// rangeStart returns the index of the '[' opening a trailing [window], ignoring brackets inside
+// quoted label values (e.g. a regex like "[0-3],0"), or -1 when there is none
+func rangeStart(s string) int {
+	if !strings.HasSuffix(s, "]") {
+		return -1
+	}
+	open := -1
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			open = i
+		}
+	}
+	return open
+}
+
+// ParseDuration parses a duration like "30s", "1m", "1h30m" or "1d" (PromQL also allows d and w)
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.Atoi(strings.TrimSuffix(s, suffix)); err == nil && strings.HasSuffix(s, suffix) {
+			return time.Duration(n) * unit, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid duration %q", s)
+}
@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bucket is one _bucket{le="..."} sample of a histogram: the number of observations <= upper
+type bucket struct {
+	upper  float64
+	count  float64
+	key    string // histogram series (name without _bucket, labels without le)
+	series Sample // the histogram series this bucket belongs to
+}
+
+// histogram collects the buckets of one series for histogram_quantile
+type histogram struct {
+	slot    int // index in the evaluated Series
+	series  SeriesSample
+	buckets []bucket
+}
+
+// parseBucket reads a _bucket sample's le bound; ok is false for samples without a valid le
+func parseBucket(sample Sample) (bucket, bool) {
+	le, ok := sample.Labels["le"]
+	if !ok {
+		return bucket{}, false
+	}
+	upper, err := ParseValue(strings.TrimSpace(le))
+	if err != nil {
+		return bucket{}, false
+	}
+	labels := make(map[string]string, len(sample.Labels)-1)
+	for k, v := range sample.Labels {
+		if k != "le" {
+			labels[k] = v
+		}
+	}
+	series := Sample{Name: strings.TrimSuffix(sample.Name, "_bucket"), Labels: labels, Timestamp: sample.Timestamp}
+	return bucket{upper: upper, count: sample.Value, key: series.String(), series: series}, true
+}
+
+// bucketQuantile estimates the φ-quantile from cumulative buckets like Prometheus does: find the
+// bucket the rank falls in and interpolate linearly inside it (the lowest bucket starts at 0
+// unless its bound is negative). Returns NaN without a +Inf bucket or observations, and the
+// highest finite bound when the rank falls in the +Inf bucket.
+func bucketQuantile(q float64, buckets []bucket) float64 {
+	switch {
+	case math.IsNaN(q):
+		return math.NaN()
+	case q < 0:
+		return math.Inf(-1)
+	case q > 1:
+		return math.Inf(1)
+	}
+	sorted := make([]bucket, len(buckets))
+	copy(sorted, buckets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].upper < sorted[j].upper })
+	if len(sorted) < 2 || !math.IsInf(sorted[len(sorted)-1].upper, 1) {
+		return math.NaN()
+	}
+	for i := range sorted {
+		if math.IsNaN(sorted[i].count) {
+			return math.NaN()
+		}
+		// counts are cumulative; rates of separately reset buckets can dip, so keep them monotonic
+		if i > 0 && sorted[i].count < sorted[i-1].count {
+			sorted[i].count = sorted[i-1].count
+		}
+	}
+
+	observations := sorted[len(sorted)-1].count
+	if observations == 0 {
+		return math.NaN()
+	}
+	rank := q * observations
+	b := sort.Search(len(sorted)-1, func(i int) bool { return sorted[i].count >= rank })
+	if b == len(sorted)-1 {
+		return sorted[len(sorted)-2].upper
+	}
+	if b == 0 && sorted[0].upper <= 0 {
+		return sorted[0].upper
+	}
+	start, below := 0.0, 0.0
+	if b > 0 {
+		start, below = sorted[b-1].upper, sorted[b-1].count
+	}
+	end, count := sorted[b].upper, sorted[b].count-below
+	if count == 0 {
+		return end
+	}
+	return start + (end-start)*(rank-below)/count
+}
+
+// formatQuantile renders φ as a percentile, e.g. 0.99 => "99", 0.999 => "99.9"
+func formatQuantile(q float64) string {
+	return strconv.FormatFloat(math.Round(q*100*1e6)/1e6, 'f', -1, 64)
+}
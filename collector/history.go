@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"math"
+	"time"
+)
+
+// History is a fixed-size ring buffer of scrapes: one timestamp per scrape and one value per
+// series (NaN where a series was missing). The oldest scrape is overwritten once it is full,
+// so appending never reallocates however long the dashboard runs.
+type History struct {
+	times  []time.Time
+	series [][]float64 // series[i][slot], same slots as times
+	start  int         // slot of the oldest scrape
+	size   int         // scrapes stored
+}
+
+// NewHistory creates a history keeping the last capacity scrapes (at least 2)
+func NewHistory(capacity int) *History {
+	if capacity < 2 {
+		capacity = 2
+	}
+	return &History{times: make([]time.Time, capacity)}
+}
+
+// Cap returns how many scrapes are kept
+func (h *History) Cap() int {
+	return len(h.times)
+}
+
+// Len returns how many scrapes are stored
+func (h *History) Len() int {
+	return h.size
+}
+
+// AddSeries adds a series (NaN for the scrapes before it appeared) and returns its index
+func (h *History) AddSeries() int {
+	values := make([]float64, len(h.times))
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	h.series = append(h.series, values)
+	return len(h.series) - 1
+}
+
+// NumSeries returns how many series have been added
+func (h *History) NumSeries() int {
+	return len(h.series)
+}
+
+// Append records a scrape; values[i] belongs to series i (missing entries are NaN)
+func (h *History) Append(t time.Time, values []float64) {
+	slot := (h.start + h.size) % len(h.times)
+	if h.size == len(h.times) {
+		h.start = (h.start + 1) % len(h.times) // full: overwrite the oldest
+	} else {
+		h.size++
+	}
+	h.times[slot] = t
+	for i, s := range h.series {
+		s[slot] = math.NaN()
+		if i < len(values) {
+			s[slot] = values[i]
+		}
+	}
+}
+
+// Times returns the scrape times, oldest first
+func (h *History) Times() []time.Time {
+	out := make([]time.Time, h.size)
+	for i := range out {
+		out[i] = h.times[(h.start+i)%len(h.times)]
+	}
+	return out
+}
+
+// Series returns series i's values, oldest first
+func (h *History) Series(i int) []float64 {
+	out := make([]float64, h.size)
+	for j := range out {
+		out[j] = h.series[i][(h.start+j)%len(h.times)]
+	}
+	return out
+}
+
+// Lines returns every series, oldest first (the shape widgets.Plot.Data expects)
+func (h *History) Lines() [][]float64 {
+	out := make([][]float64, len(h.series))
+	for i := range out {
+		out[i] = h.Series(i)
+	}
+	return out
+}
+
+// Span returns the time between the oldest and newest scrape
+func (h *History) Span() time.Duration {
+	if h.size < 2 {
+		return 0
+	}
+	return h.times[(h.start+h.size-1)%len(h.times)].Sub(h.times[h.start])
+}
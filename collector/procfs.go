@@ -0,0 +1,274 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Readers for Linux /proc and /sys. Each takes the filesystem root they live under ("" or "/"
+// for this machine), so a copy of another machine's files (or a test fixture tree) can be read
+// the same way.
+
+// sectorSize is the unit of the sector counts in /proc/diskstats, whatever the device's real sector size
+const sectorSize = 512
+
+// CPUTimes is one CPU's line of /proc/stat: time spent in each mode since boot, in clock ticks
+type CPUTimes struct {
+	CPU                               string // "0", "1", ...
+	User, Nice, System, Idle, IOWait  float64
+	IRQ, SoftIRQ, Steal, Guest, GNice float64
+}
+
+// Total is the time spent in all modes (guest time is already counted in user and nice)
+func (c CPUTimes) Total() float64 {
+	return c.User + c.Nice + c.System + c.Idle + c.IOWait + c.IRQ + c.SoftIRQ + c.Steal
+}
+
+// IdleAll is the idle time including time waiting for IO
+func (c CPUTimes) IdleAll() float64 {
+	return c.Idle + c.IOWait
+}
+
+// NetDevStats is one interface's line of /proc/net/dev (counters since boot)
+type NetDevStats struct {
+	Interface                               string
+	RxBytes, RxPackets, RxErrors, RxDropped float64
+	TxBytes, TxPackets, TxErrors, TxDropped float64
+}
+
+// DiskStats is one block device's line of /proc/diskstats (counters since boot)
+type DiskStats struct {
+	Device                                       string
+	ReadsCompleted, SectorsRead, ReadTimeMs      float64
+	WritesCompleted, SectorsWritten, WriteTimeMs float64
+	IOInProgress, IOTimeMs                       float64
+}
+
+// ReadBytes is SectorsRead in bytes
+func (d DiskStats) ReadBytes() float64 {
+	return d.SectorsRead * sectorSize
+}
+
+// WrittenBytes is SectorsWritten in bytes
+func (d DiskStats) WrittenBytes() float64 {
+	return d.SectorsWritten * sectorSize
+}
+
+// CPUFreq is one CPU's current frequency from /sys/devices/system/cpu/cpuN/cpufreq
+type CPUFreq struct {
+	CPU string // "0", "1", ...
+	MHz float64
+}
+
+// procPath joins a path under /proc or /sys to the root
+func procPath(root string, parts ...string) string {
+	if root == "" {
+		root = "/"
+	}
+	return filepath.Join(append([]string{root}, parts...)...)
+}
+
+// parseFloats parses whitespace-separated numbers; missing ones (older kernels print fewer
+// columns) stay 0
+func parseFloats(fields []string, out ...*float64) error {
+	for i, p := range out {
+		if i >= len(fields) {
+			return nil
+		}
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return err
+		}
+		*p = v
+	}
+	return nil
+}
+
+// ReadCPUStat reads the per-CPU lines of /proc/stat (cpu0, cpu1, ...), in CPU order
+func ReadCPUStat(root string) ([]CPUTimes, error) {
+	path := procPath(root, "proc", "stat")
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var cpus []CPUTimes
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		c := CPUTimes{CPU: strings.TrimPrefix(fields[0], "cpu")}
+		if err := parseFloats(fields[1:], &c.User, &c.Nice, &c.System, &c.Idle, &c.IOWait,
+			&c.IRQ, &c.SoftIRQ, &c.Steal, &c.Guest, &c.GNice); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, fields[0], err)
+		}
+		cpus = append(cpus, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("%s: no cpu lines", path)
+	}
+	return cpus, nil
+}
+
+// ReadMemInfo reads /proc/meminfo into bytes by field name (MemTotal, MemAvailable, SwapFree, ...);
+// fields without a unit (HugePages_Total, ...) are counts
+func ReadMemInfo(root string) (map[string]float64, error) {
+	path := procPath(root, "proc", "meminfo")
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info := map[string]float64{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		fields := strings.Fields(rest)
+		if !ok || len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		info[name] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := info["MemTotal"]; !ok {
+		return nil, fmt.Errorf("%s: no MemTotal", path)
+	}
+	return info, nil
+}
+
+// ReadNetDev reads /proc/net/dev, one entry per interface in file order
+func ReadNetDev(root string) ([]NetDevStats, error) {
+	path := procPath(root, "proc", "net", "dev")
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var out []NetDevStats
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// the two header lines have no colon before the counters
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.Contains(name, "|") {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("%s: %s: expected 16 counters, got %d", path, strings.TrimSpace(name), len(fields))
+		}
+		s := NetDevStats{Interface: strings.TrimSpace(name)}
+		if err := parseFloats(fields, &s.RxBytes, &s.RxPackets, &s.RxErrors, &s.RxDropped); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, s.Interface, err)
+		}
+		if err := parseFloats(fields[8:], &s.TxBytes, &s.TxPackets, &s.TxErrors, &s.TxDropped); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, s.Interface, err)
+		}
+		out = append(out, s)
+	}
+	return out, scanner.Err()
+}
+
+// ReadDiskStats reads /proc/diskstats, one entry per device (partitions included) in file order
+func ReadDiskStats(root string) ([]DiskStats, error) {
+	path := procPath(root, "proc", "diskstats")
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var out []DiskStats
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// major minor name reads merged sectors ms writes merged sectors ms in-progress io-ms ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+		d := DiskStats{Device: fields[2]}
+		var merged float64
+		if err := parseFloats(fields[3:], &d.ReadsCompleted, &merged, &d.SectorsRead, &d.ReadTimeMs,
+			&d.WritesCompleted, &merged, &d.SectorsWritten, &d.WriteTimeMs, &d.IOInProgress, &d.IOTimeMs); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, d.Device, err)
+		}
+		out = append(out, d)
+	}
+	return out, scanner.Err()
+}
+
+// BlockDevices lists the whole disks in /sys/block (partitions aren't there), or nil when /sys
+// isn't readable
+func BlockDevices(root string) []string {
+	entries, err := os.ReadDir(procPath(root, "sys", "block"))
+	if err != nil {
+		return nil
+	}
+	devices := make([]string, 0, len(entries))
+	for _, e := range entries {
+		devices = append(devices, e.Name())
+	}
+	return devices
+}
+
+// ReadCPUFreq reads every CPU's current frequency from /sys/devices/system/cpu/cpuN/cpufreq
+// (scaling_cur_freq, else cpuinfo_cur_freq), in CPU order. CPUs without cpufreq (common in VMs)
+// are left out.
+func ReadCPUFreq(root string) ([]CPUFreq, error) {
+	dirs, err := filepath.Glob(procPath(root, "sys", "devices", "system", "cpu", "cpu[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	var out []CPUFreq
+	for _, dir := range dirs {
+		for _, name := range []string{"scaling_cur_freq", "cpuinfo_cur_freq"} {
+			raw, err := os.ReadFile(filepath.Join(dir, "cpufreq", name))
+			if err != nil {
+				continue
+			}
+			khz, err := strconv.ParseFloat(strings.TrimSpace(string(raw)), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filepath.Join(dir, "cpufreq", name), err)
+			}
+			out = append(out, CPUFreq{CPU: strings.TrimPrefix(filepath.Base(dir), "cpu"), MHz: khz / 1000})
+			break
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, _ := strconv.Atoi(out[i].CPU)
+		b, _ := strconv.Atoi(out[j].CPU)
+		return a < b
+	})
+	return out, nil
+}
+
+// ReadUptime reads the seconds since boot from /proc/uptime
+func ReadUptime(root string) (float64, error) {
+	path := procPath(root, "proc", "uptime")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%s: empty", path)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testdata/sysroot is a small /proc and /sys tree: two CPUs (cpufreq on cpu0, cpu1 and cpu10,
+// none on cpu2), loopback, a busy and an idle interface, a disk with a partition, an unused disk
+// and a loop device
+const sysroot = "testdata/sysroot"
+
+func TestReadCPUStat(t *testing.T) {
+	cpus, err := ReadCPUStat(sysroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CPUTimes{
+		{CPU: "0", User: 1393, Nice: 280, System: 283, Idle: 1836900, IOWait: 11150, SoftIRQ: 123},
+		{CPU: "1", User: 3312, Nice: 76, System: 301, Idle: 1862276, IOWait: 11910, SoftIRQ: 154},
+	}
+	if !slices.Equal(cpus, want) {
+		t.Errorf("ReadCPUStat = %+v, want %+v", cpus, want)
+	}
+	if got := cpus[0].Total(); got != 1850129 {
+		t.Errorf("cpu0 Total = %v, want 1850129", got)
+	}
+	if got := cpus[0].IdleAll(); got != 1848050 {
+		t.Errorf("cpu0 IdleAll = %v, want 1848050", got)
+	}
+}
+
+func TestReadMemInfo(t *testing.T) {
+	info, err := ReadMemInfo(sysroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		field string
+		want  float64
+	}{
+		{"MemTotal", 8000000 * 1024},
+		{"MemAvailable", 2000000 * 1024},
+		{"SwapFree", 750000 * 1024},
+		{"HugePages_Total", 0}, // a count, not kB
+		{"Hugepagesize", 2048 * 1024},
+	}
+	for _, tt := range tests {
+		if got, ok := info[tt.field]; !ok || got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestReadNetDev(t *testing.T) {
+	devs, err := ReadNetDev(sysroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NetDevStats{
+		{Interface: "lo", RxBytes: 1000000, RxPackets: 5000, TxBytes: 1000000, TxPackets: 5000},
+		{Interface: "eth0", RxBytes: 2000000, RxPackets: 1500, RxErrors: 1, RxDropped: 2, TxBytes: 500000, TxPackets: 1200, TxDropped: 3},
+		{Interface: "wlan0"},
+	}
+	if !slices.Equal(devs, want) {
+		t.Errorf("ReadNetDev = %+v, want %+v", devs, want)
+	}
+}
+
+func TestReadDiskStats(t *testing.T) {
+	stats, err := ReadDiskStats(sysroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range stats {
+		names = append(names, d.Device)
+	}
+	if want := []string{"sda", "sda1", "nvme0n1", "loop0"}; !slices.Equal(names, want) {
+		t.Fatalf("devices = %v, want %v", names, want)
+	}
+	sda := stats[0]
+	if sda.ReadsCompleted != 1000 || sda.ReadBytes() != 20000*512 || sda.WrittenBytes() != 8000*512 || sda.IOTimeMs != 700 {
+		t.Errorf("sda = %+v", sda)
+	}
+	if devices := BlockDevices(sysroot); !slices.Equal(devices, []string{"nvme0n1", "sda"}) {
+		t.Errorf("BlockDevices = %v, want [nvme0n1 sda]", devices)
+	}
+}
+
+func TestReadCPUFreq(t *testing.T) {
+	freqs, err := ReadCPUFreq(sysroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cpuinfo_cur_freq stands in for a missing scaling_cur_freq; cpu10 sorts after cpu1
+	want := []CPUFreq{{CPU: "0", MHz: 2400}, {CPU: "1", MHz: 1800}, {CPU: "10", MHz: 3000}}
+	if !slices.Equal(freqs, want) {
+		t.Errorf("ReadCPUFreq = %v, want %v", freqs, want)
+	}
+}
+
+func TestReadUptime(t *testing.T) {
+	uptime, err := ReadUptime(sysroot)
+	if err != nil || uptime != 1000.5 {
+		t.Errorf("ReadUptime = %v, %v; want 1000.5", uptime, err)
+	}
+}
+
+func TestProcfsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string // under proc/
+		data  string
+		read  func(root string) error
+		wants string
+	}{
+		{
+			name: "stat without cpu lines", file: "stat", data: "intr 1 2 3\n",
+			read:  func(root string) error { _, err := ReadCPUStat(root); return err },
+			wants: "no cpu lines",
+		},
+		{
+			name: "stat with a bad number", file: "stat", data: "cpu0 1 2 x 4\n",
+			read:  func(root string) error { _, err := ReadCPUStat(root); return err },
+			wants: "cpu0",
+		},
+		{
+			name: "meminfo without MemTotal", file: "meminfo", data: "MemFree: 10 kB\n",
+			read:  func(root string) error { _, err := ReadMemInfo(root); return err },
+			wants: "no MemTotal",
+		},
+		{
+			name: "net/dev with missing counters", file: "net/dev", data: "eth0: 1 2 3\n",
+			read:  func(root string) error { _, err := ReadNetDev(root); return err },
+			wants: "expected 16 counters",
+		},
+		{
+			name: "empty uptime", file: "uptime", data: "",
+			read:  func(root string) error { _, err := ReadUptime(root); return err },
+			wants: "empty",
+		},
+		{
+			name: "missing file", file: "unused", data: "",
+			read:  func(root string) error { _, err := ReadDiskStats(root); return err },
+			wants: "diskstats",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			path := filepath.Join(root, "proc", tt.file)
+			os.MkdirAll(filepath.Dir(path), 0o755)
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.read(root); err == nil || !strings.Contains(err.Error(), tt.wants) {
+				t.Errorf("err = %v, want one containing %q", err, tt.wants)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterSource("promql", newPromQLSource)
+}
+
+// promqlSource graphs PromQL queries evaluated by a Prometheus-compatible server
+// (/api/v1/query_range). The first collection loads cfg.Range of past results at once, so the
+// widget starts out full; after that each interval asks only for the steps since the newest
+// point it has. Batches carry the server's timestamps, one batch per step.
+type promqlSource struct {
+	scraper  *Scraper
+	endpoint string
+	queries  []string
+	step     time.Duration
+	lookback time.Duration
+	title    string
+	cancel   context.CancelFunc
+	last     time.Time // newest step sent; zero before the first load
+	sent     bool      // a batch went out (so empty refreshes can stay quiet)
+}
+
+// newPromQLSource queries the server at cfg.URL (see QueryRangeURL) for every expression in
+// cfg.Exprs, every cfg.Interval, which is also the step between points
+func newPromQLSource(cfg SourceConfig) (Source, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("promql source: no server URL")
+	}
+	if len(cfg.Exprs) == 0 {
+		return nil, fmt.Errorf("promql source: no query")
+	}
+	httpCfg := cfg.HTTP
+	if httpCfg.Timeout <= 0 {
+		httpCfg.Timeout = cfg.Timeout
+	}
+	scraper, err := NewScraper(httpCfg)
+	if err != nil {
+		return nil, err
+	}
+	// Prometheus refuses more points per series than this in one query
+	lookback := min(cfg.Range, time.Duration(maxRangePoints-1)*cfg.Interval)
+	title := "PromQL: " + cfg.Exprs[0]
+	if len(cfg.Exprs) > 1 {
+		title = fmt.Sprintf("PromQL (%d queries)", len(cfg.Exprs))
+	}
+	return &promqlSource{
+		scraper:  scraper,
+		endpoint: QueryRangeURL(cfg.URL),
+		queries:  cfg.Exprs,
+		step:     cfg.Interval,
+		lookback: lookback,
+		title:    title,
+	}, nil
+}
+
+func (p *promqlSource) Title() string {
+	return p.title
+}
+
+// Start loads the past right away, then polls for new steps every interval until Stop
+func (p *promqlSource) Start(out chan<- Batch) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go func() {
+		ticker := time.NewTicker(p.step)
+		defer ticker.Stop()
+		for {
+			for _, batch := range p.collect(ctx, time.Now()) {
+				batch.Source = p
+				select {
+				case out <- batch:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// collect runs every query over the steps after the newest one sent, up to now, and returns one
+// batch per step (all but the last marked More). Queries that fail are reported on the last
+// batch; the others are still graphed, like the targets that answered a multi-target scrape.
+func (p *promqlSource) collect(ctx context.Context, now time.Time) []Batch {
+	start := p.last.Add(p.step)
+	if p.last.IsZero() {
+		// steps on multiples of the step, like Grafana, so refreshes line up with the first load
+		start = now.Add(-p.lookback).Truncate(p.step)
+	}
+	if start.After(now) {
+		return nil
+	}
+
+	results := make([][]RangeSeries, len(p.queries))
+	errs := make([]error, len(p.queries))
+	var wg sync.WaitGroup
+	for i, query := range p.queries {
+		wg.Go(func() {
+			results[i], errs[i] = p.scraper.QueryRange(ctx, p.endpoint, query, start, now, p.step)
+		})
+	}
+	wg.Wait()
+	err := queriesError(p.queries, errs)
+
+	steps := map[time.Time][]Reading{}
+	for i, series := range results {
+		for _, s := range series {
+			sample := Sample{Name: s.Name, Labels: s.Labels}
+			key := strconv.Itoa(i) + " " + sample.String()
+			for j, t := range s.Times {
+				if !t.After(p.last) {
+					continue // the server answered with a step we already have
+				}
+				sample.Value = s.Values[j]
+				steps[t] = append(steps[t], Reading{Key: key, Group: p.queries[i], Sample: sample})
+			}
+		}
+	}
+	if len(steps) == 0 {
+		if p.sent && err == nil {
+			return nil
+		}
+		p.sent = true
+		return []Batch{{Time: now, Err: err}} // without an error, says "no matching series"
+	}
+	times := make([]time.Time, 0, len(steps))
+	for t := range steps {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	batches := make([]Batch, len(times))
+	for i, t := range times {
+		batches[i] = Batch{Time: t, Readings: steps[t], More: i < len(times)-1}
+	}
+	batches[len(batches)-1].Err = err
+	p.last, p.sent = times[len(times)-1], true
+	return batches
+}
+
+// queriesError sums up the failed queries, or returns nil when none failed
+func queriesError(queries []string, errs []error) error {
+	var failed []string
+	var first error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if first == nil {
+			first = err
+		}
+		failed = append(failed, queries[i])
+	}
+	switch {
+	case len(failed) == 0:
+		return nil
+	case len(queries) == 1:
+		return first
+	}
+	return fmt.Errorf("%d/%d queries failed (%s), %w", len(failed), len(queries), strings.Join(failed, ", "), first)
+}
+
+// Stop ends polling, abandoning a query in progress
+func (p *promqlSource) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+}
@@ -0,0 +1,347 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseMatrix(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []RangeSeries
+		wantErr string
+	}{
+		{
+			name: "series",
+			body: `{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{"__name__":"up","job":"node"},"values":[[1700000000,"1"],[1700000015.5,"0"]]},
+				{"metric":{"job":"api"},"values":[[1700000000,"NaN"]]}]}}`,
+			want: []RangeSeries{
+				{Name: "up", Labels: map[string]string{"job": "node"},
+					Times:  []time.Time{time.Unix(1700000000, 0), time.UnixMilli(1700000015500)},
+					Values: []float64{1, 0}},
+				{Labels: map[string]string{"job": "api"},
+					Times:  []time.Time{time.Unix(1700000000, 0)},
+					Values: []float64{math.NaN()}},
+			},
+		},
+		{
+			name: "no series",
+			body: `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+			want: []RangeSeries{},
+		},
+		{
+			name:    "API error",
+			body:    `{"status":"error","errorType":"bad_data","error":"parse error at char 4"}`,
+			wantErr: "query range: bad_data: parse error at char 4",
+		},
+		{
+			name:    "not a matrix",
+			body:    `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			wantErr: `expected a matrix, got "vector"`,
+		},
+		{
+			name:    "value not a string",
+			body:    `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1700000000,1]]}]}}`,
+			wantErr: "bad point",
+		},
+		{
+			name:    "bad value",
+			body:    `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1700000000,"one"]]}]}}`,
+			wantErr: `bad value "one"`,
+		},
+		{
+			name:    "not JSON",
+			body:    `<html>bad gateway</html>`,
+			wantErr: "parse query range response",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMatrix([]byte(tt.body))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseMatrix error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d series, want %d", len(got), len(tt.want))
+			}
+			for i, s := range got {
+				want := tt.want[i]
+				if s.Name != want.Name || fmt.Sprint(s.Labels) != fmt.Sprint(want.Labels) || len(s.Values) != len(want.Values) {
+					t.Errorf("series %d = %+v, want %+v", i, s, want)
+					continue
+				}
+				for j := range s.Values {
+					if !s.Times[j].Equal(want.Times[j]) || !sameValue(s.Values[j], want.Values[j]) {
+						t.Errorf("series %d point %d = %v %v, want %v %v", i, j, s.Times[j], s.Values[j], want.Times[j], want.Values[j])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	const matrix = `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"up"},"values":[[1700000000,"1"]]}]}}`
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr string // "" when the matrix is expected
+	}{
+		{
+			name: "matrix",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				if r.URL.Path != queryRangePath || q.Get("query") != "up" || q.Get("start") != "1699999700.000" ||
+					q.Get("end") != "1700000000.000" || q.Get("step") != "15" {
+					t.Errorf("request = %s", r.URL)
+				}
+				w.Write([]byte(matrix))
+			},
+		},
+		{
+			// Prometheus answers bad queries with 400 and says why in the body
+			name: "API error body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"1:3: parse error: unexpected <op:+>"}`))
+			},
+			wantErr: "query range: bad_data: 1:3: parse error: unexpected <op:+>",
+		},
+		{
+			name: "error page",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "<html>upstream down</html>", http.StatusBadGateway)
+			},
+			wantErr: "query range: status 502 Bad Gateway",
+		},
+		{
+			// a proxy's error with a body that happens to be a query result is still an error
+			name: "matrix with error status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(matrix))
+			},
+			wantErr: "query range: status 503 Service Unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			s := NewScraperWithClient(server.Client(), ScrapeConfig{})
+			end := time.Unix(1700000000, 0)
+			series, err := s.QueryRange(context.Background(), QueryRangeURL(server.URL), "up", end.Add(-5*time.Minute), end, 15*time.Second)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("QueryRange error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(series) != 1 || series[0].Name != "up" || len(series[0].Values) != 1 {
+				t.Errorf("QueryRange = %+v, want one up point", series)
+			}
+		})
+	}
+}
+
+// rangeServer answers query_range with one point per step, valued at its Unix time; for the
+// query "fail" it answers with an API error
+type rangeServer struct {
+	align  time.Duration // answer from the multiple of align at or before start, like servers that align ranges their own way
+	mu     sync.Mutex
+	starts []time.Time // the start of each request
+}
+
+func (rs *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	parse := func(name string) time.Time {
+		v, _ := strconv.ParseFloat(q.Get(name), 64)
+		return time.UnixMilli(int64(math.Round(v * 1000)))
+	}
+	start, end := parse("start"), parse("end")
+	step, _ := strconv.ParseFloat(q.Get("step"), 64)
+	rs.mu.Lock()
+	rs.starts = append(rs.starts, start)
+	rs.mu.Unlock()
+
+	if q.Get("query") == "fail" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"status":"error","errorType":"execution","error":"query timed out"}`))
+		return
+	}
+	var values []string
+	for t := start.Truncate(rs.align); !t.After(end); t = t.Add(time.Duration(step * float64(time.Second))) {
+		values = append(values, fmt.Sprintf(`[%d,"%d"]`, t.Unix(), t.Unix()))
+	}
+	fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"up","job":"node"},"values":[%s]}]}}`,
+		strings.Join(values, ","))
+}
+
+func TestPromQLSourceCollect(t *testing.T) {
+	rs := &rangeServer{align: 30 * time.Second}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+
+	src, err := NewSource("promql", SourceConfig{URL: server.URL, Exprs: []string{"up"}, Interval: 15 * time.Second, Range: 5 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := src.(*promqlSource)
+	now := time.Unix(1700000017, 0) // 1700000010 is on a multiple of 15s (and of 30s)
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		wantStart time.Time // of the request; zero when none is expected
+		wantSteps []int64   // Unix times of the batches
+	}{
+		{
+			name:      "first load",
+			now:       now,
+			wantStart: time.Unix(1700000010-300, 0),
+			wantSteps: steps(1700000010-300, 1700000010, 15),
+		},
+		{
+			// asks from the step after the newest one sent; the server's repeat of it is skipped
+			name:      "refresh",
+			now:       now.Add(30 * time.Second),
+			wantStart: time.Unix(1700000025, 0),
+			wantSteps: []int64{1700000025, 1700000040},
+		},
+		{
+			name: "no new step yet",
+			now:  now.Add(35 * time.Second),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs.mu.Lock()
+			rs.starts = nil
+			rs.mu.Unlock()
+
+			batches := p.collect(context.Background(), tt.now)
+			if tt.wantStart.IsZero() {
+				if len(rs.starts) != 0 || len(batches) != 0 {
+					t.Errorf("%d requests, %d batches; want none", len(rs.starts), len(batches))
+				}
+				return
+			}
+			if len(rs.starts) != 1 || !rs.starts[0].Equal(tt.wantStart) {
+				t.Errorf("requests started at %v, want %v", rs.starts, tt.wantStart)
+			}
+			checkSteps(t, batches, tt.wantSteps)
+		})
+	}
+}
+
+func TestPromQLSourceLookbackClamp(t *testing.T) {
+	rs := &rangeServer{}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+
+	// a day at 1s steps is more points than Prometheus returns for one query
+	src, err := NewSource("promql", SourceConfig{URL: server.URL, Exprs: []string{"up"}, Interval: time.Second, Range: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000010, 0)
+	batches := src.(*promqlSource).collect(context.Background(), now)
+	if want := now.Add(-(maxRangePoints - 1) * time.Second); len(rs.starts) != 1 || !rs.starts[0].Equal(want) {
+		t.Errorf("requests started at %v, want %v", rs.starts, want)
+	}
+	if len(batches) != maxRangePoints {
+		t.Errorf("%d batches, want %d", len(batches), maxRangePoints)
+	}
+}
+
+func TestPromQLSourceErrors(t *testing.T) {
+	rs := &rangeServer{}
+	server := httptest.NewServer(rs)
+	defer server.Close()
+	now := time.Unix(1700000010, 0)
+
+	tests := []struct {
+		name      string
+		exprs     []string
+		wantSteps []int64
+		wantErr   string // on the last batch
+	}{
+		{
+			name:    "API error",
+			exprs:   []string{"fail"},
+			wantErr: "query range: execution: query timed out",
+		},
+		{
+			// the query that answered is still graphed
+			name:      "one of two queries fails",
+			exprs:     []string{"up", "fail"},
+			wantSteps: []int64{1700000010 - 30, 1700000010 - 15, 1700000010},
+			wantErr:   "1/2 queries failed (fail), query range: execution: query timed out",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := NewSource("promql", SourceConfig{URL: server.URL, Exprs: tt.exprs, Interval: 15 * time.Second, Range: 30 * time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			batches := src.(*promqlSource).collect(context.Background(), now)
+			if len(batches) == 0 {
+				t.Fatal("no batches")
+			}
+			if err := batches[len(batches)-1].Err; err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.wantSteps != nil {
+				checkSteps(t, batches, tt.wantSteps)
+			}
+		})
+	}
+}
+
+// steps lists the Unix times from first to last, every step seconds
+func steps(first, last, step int64) []int64 {
+	var out []int64
+	for t := first; t <= last; t += step {
+		out = append(out, t)
+	}
+	return out
+}
+
+// checkSteps checks there is a batch per step, oldest first, all but the last marked More, each
+// holding the up series valued at its time
+func checkSteps(t *testing.T, batches []Batch, want []int64) {
+	t.Helper()
+	if len(batches) != len(want) {
+		t.Fatalf("%d batches, want %d", len(batches), len(want))
+	}
+	for i, batch := range batches {
+		if batch.Time.Unix() != want[i] || batch.More != (i < len(want)-1) {
+			t.Errorf("batch %d at %d (More %v), want %d", i, batch.Time.Unix(), batch.More, want[i])
+		}
+		if len(batch.Readings) != 1 || batch.Readings[0].Key != `0 up{job="node"}` || batch.Readings[0].Value != float64(want[i]) {
+			t.Errorf("batch %d readings = %+v", i, batch.Readings)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryRangePath is where Prometheus-compatible servers (Prometheus, Thanos, VictoriaMetrics,
+// Mimir) answer range queries
+const queryRangePath = "/api/v1/query_range"
+
+// maxRangePoints is the most points per series Prometheus returns for one range query
+const maxRangePoints = 11000
+
+// QueryRangeURL turns a Prometheus server address into its query_range endpoint:
+// localhost:9090 => http://localhost:9090/api/v1/query_range. Addresses with a path prefix
+// (http://thanos/prom) keep it; a URL already ending in /api/v1/query_range is used as is.
+func QueryRangeURL(server string) string {
+	server = strings.TrimSpace(server)
+	if server == "" {
+		return ""
+	}
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return server // the query reports it
+	}
+	if !strings.HasSuffix(u.Path, queryRangePath) {
+		u.Path = strings.TrimSuffix(u.Path, "/") + queryRangePath
+	}
+	return u.String()
+}
+
+// RangeSeries is one series of a range query result, its values oldest first
+type RangeSeries struct {
+	Name   string            // __name__; "" for computed series (rate(...), sums)
+	Labels map[string]string // the other labels
+	Times  []time.Time
+	Values []float64
+}
+
+// QueryRange evaluates a PromQL query at every step from start to end through a
+// Prometheus-compatible HTTP API (endpoint is a QueryRangeURL), with the scraper's timeout,
+// authentication and TLS settings
+func (s *Scraper) QueryRange(ctx context.Context, endpoint, query string, start, end time.Time, step time.Duration) ([]RangeSeries, error) {
+	timeout := s.cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultScrapeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", formatAPITime(start))
+	params.Set("end", formatAPITime(end))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	u := endpoint + "?" + params.Encode()
+	if strings.Contains(endpoint, "?") {
+		u = endpoint + "&" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("query range: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("query range: timed out after %s", timeout)
+		}
+		return nil, fmt.Errorf("query range: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := readBody(resp)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("query range: timed out after %s", timeout)
+		}
+		return nil, fmt.Errorf("query range: %w", err)
+	}
+	series, err := parseMatrix(body)
+	var apiErr *queryError
+	if resp.StatusCode != http.StatusOK && !errors.As(err, &apiErr) {
+		// the API explains bad queries in a JSON error body; anything else is an error page
+		return nil, fmt.Errorf("query range: status %s", resp.Status)
+	}
+	return series, err
+}
+
+// queryError is an error the API answered with, e.g. a PromQL syntax error
+type queryError struct {
+	msg string
+}
+
+func (e *queryError) Error() string {
+	return "query range: " + e.msg
+}
+
+// formatAPITime formats a time the way the API takes it: Unix seconds with milliseconds
+func formatAPITime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64)
+}
+
+// parseMatrix reads a query_range response:
+//
+//	{"status": "success", "data": {"resultType": "matrix", "result": [
+//	  {"metric": {"__name__": "up", "job": "node"}, "values": [[1700000000.5, "1"], ...]}, ...]}}
+//
+// An error response ({"status": "error", "error": "..."}) is returned as an error.
+func parseMatrix(body []byte) ([]RangeSeries, error) {
+	var resp struct {
+		Status    string `json:"status"`
+		ErrorType string `json:"errorType"`
+		Error     string `json:"error"`
+		Data      struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Metric map[string]string `json:"metric"`
+				Values [][2]any          `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("parse query range response: %w", err)
+	}
+	if resp.Status != "success" {
+		msg := resp.Error
+		if resp.ErrorType != "" {
+			msg = resp.ErrorType + ": " + msg
+		}
+		return nil, &queryError{msg: msg}
+	}
+	if resp.Data.ResultType != "matrix" {
+		return nil, fmt.Errorf("parse query range response: expected a matrix, got %q", resp.Data.ResultType)
+	}
+	out := make([]RangeSeries, len(resp.Data.Result))
+	for i, r := range resp.Data.Result {
+		series := RangeSeries{Name: r.Metric["__name__"], Labels: map[string]string{}}
+		for k, v := range r.Metric {
+			if k != "__name__" {
+				series.Labels[k] = v
+			}
+		}
+		for _, point := range r.Values {
+			ts, ok := point[0].(float64)
+			raw, isString := point[1].(string)
+			if !ok || !isString {
+				return nil, fmt.Errorf("parse query range response: bad point %v", point)
+			}
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse query range response: bad value %q", raw)
+			}
+			series.Times = append(series.Times, time.UnixMilli(int64(math.Round(ts*1000))))
+			series.Values = append(series.Values, v)
+		}
+		out[i] = series
+	}
+	return out, nil
+}
@@ -0,0 +1,214 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A recording holds raw scrapes, one gzip member per scrape round appended to the file (so the
+// whole file is readable with zcat). Inside, every target of the round is one entry:
+//
+//	2024-05-01T10:00:00.123456789Z http://host:9100/metrics 5120 text/plain; version=0.0.4   (then 5120 bytes of page, then \n)
+//	2024-05-01T10:00:00.123456789Z http://host2:9100/metrics !fetch metrics: timed out after 10s
+//
+// Entries of one round share its timestamp (when the round started). The page's Content-Type
+// follows its length, so replays read timestamps in the right unit; older recordings without it
+// are read as the Prometheus text format.
+
+// Recorder appends raw scrapes to a recording file; one Recorder can be shared by several sources
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecorder opens (or creates) a recording file for appending
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{file: file}, nil
+}
+
+// record appends one scrape round
+func (r *Recorder) record(t time.Time, pages []page) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	stamp := t.UTC().Format(time.RFC3339Nano)
+	for _, p := range pages {
+		if p.err != nil {
+			// keep the entry on one line
+			msg := strings.ReplaceAll(p.err.Error(), "\n", " ")
+			fmt.Fprintf(gz, "%s %s !%s\n", stamp, p.target, msg)
+			continue
+		}
+		header := fmt.Sprintf("%s %s %d", stamp, p.target, len(p.body))
+		if p.contentType != "" {
+			header += " " + strings.ReplaceAll(p.contentType, "\n", " ")
+		}
+		fmt.Fprintln(gz, header)
+		gz.Write(p.body)
+		gz.Write([]byte("\n"))
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// one write per round, so rounds from different sources don't interleave
+	if _, err := r.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the recording file
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// round is one scrape round read back from a recording
+type round struct {
+	time  time.Time
+	pages []page
+}
+
+// recordingReader reads a recording round by round
+type recordingReader struct {
+	file    *os.File
+	r       *bufio.Reader
+	pending *roundEntry // first entry of the next round, already read
+}
+
+// roundEntry is one target's entry in a recording
+type roundEntry struct {
+	time time.Time
+	page page
+}
+
+// openRecording opens a recording for reading
+func openRecording(path string) (*recordingReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: not a recording: %w", path, err)
+	}
+	return &recordingReader{file: file, r: bufio.NewReader(gz)}, nil
+}
+
+// next returns the next round, or io.EOF after the last one. A round cut short at the end of the
+// file (the recording was still being written) ends the recording.
+func (rr *recordingReader) next() (round, error) {
+	var rd round
+	for {
+		entry := rr.pending
+		rr.pending = nil
+		if entry == nil {
+			var err error
+			if entry, err = rr.readEntry(); err != nil {
+				if (err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF)) && len(rd.pages) > 0 {
+					return rd, nil
+				}
+				if errors.Is(err, io.ErrUnexpectedEOF) {
+					return rd, io.EOF
+				}
+				return rd, err
+			}
+		}
+		if len(rd.pages) > 0 && !entry.time.Equal(rd.time) {
+			rr.pending = entry
+			return rd, nil
+		}
+		rd.time = entry.time
+		rd.pages = append(rd.pages, entry.page)
+	}
+}
+
+// readEntry reads one target's entry
+func (rr *recordingReader) readEntry() (*roundEntry, error) {
+	line, err := rr.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	fields := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("recording: bad entry %q", line)
+	}
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("recording: bad entry %q", line)
+	}
+	entry := &roundEntry{time: t, page: page{target: fields[1]}}
+	if msg, failed := strings.CutPrefix(fields[2], "!"); failed {
+		entry.page.err = errors.New(msg)
+		return entry, nil
+	}
+	size, contentType, _ := strings.Cut(fields[2], " ")
+	entry.page.contentType = strings.TrimSpace(contentType)
+	n, err := strconv.Atoi(size)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("recording: bad entry %q", line)
+	}
+	entry.page.body = make([]byte, n+1) // the page and its trailing newline
+	if _, err := io.ReadFull(rr.r, entry.page.body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	entry.page.body = entry.page.body[:n]
+	return entry, nil
+}
+
+// Close closes the recording
+func (rr *recordingReader) Close() error {
+	return rr.file.Close()
+}
+
+// RecordedTargets lists the targets in a recording, in the order they first appear
+func RecordedTargets(path string) ([]string, error) {
+	rr, err := openRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rr.Close()
+	var targets []string
+	seen := map[string]bool{}
+	for {
+		rd, err := rr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range rd.pages {
+			if !seen[p.target] {
+				seen[p.target] = true
+				targets = append(targets, p.target)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s: empty recording", path)
+	}
+	return targets, nil
+}
@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testdata/session.rec is three rounds 15s apart of two targets: host1 answers every time (with a
+// Content-Type), host2 times out in the second round and was recorded without one
+const sessionFixture = "testdata/session.rec"
+
+func TestRecorderRoundTrip(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+	rounds := []round{
+		{time: t0, pages: []page{
+			{target: "http://a:9100/metrics", body: []byte("up 1\n"), contentType: "text/plain; version=0.0.4"},
+			{target: "http://b:9100/metrics", body: []byte("up 1\nno_newline 2")},
+		}},
+		{time: t0.Add(15 * time.Second), pages: []page{
+			{target: "http://a:9100/metrics", err: errors.New("fetch metrics: status 503\nService Unavailable")},
+			{target: "http://b:9100/metrics", body: []byte{}},
+		}},
+		{time: t0.Add(30 * time.Second), pages: []page{
+			{target: "http://a:9100/metrics", body: []byte("# EOF\n"), contentType: "application/openmetrics-text; version=1.0.0"},
+		}},
+	}
+	path := filepath.Join(t.TempDir(), "session.rec")
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rd := range rounds {
+		if err := rec.record(rd.time, rd.pages); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec.Close()
+
+	got := readRounds(t, path)
+	if len(got) != len(rounds) {
+		t.Fatalf("read %d rounds, want %d", len(got), len(rounds))
+	}
+	for i, want := range rounds {
+		if !got[i].time.Equal(want.time) || len(got[i].pages) != len(want.pages) {
+			t.Fatalf("round %d = %v with %d pages, want %v with %d", i, got[i].time, len(got[i].pages), want.time, len(want.pages))
+		}
+		for j, wp := range want.pages {
+			gp := got[i].pages[j]
+			if gp.target != wp.target || string(gp.body) != string(wp.body) || gp.contentType != wp.contentType {
+				t.Errorf("round %d page %d = %q %q (%s), want %q %q (%s)", i, j, gp.target, gp.body, gp.contentType, wp.target, wp.body, wp.contentType)
+			}
+			if (gp.err == nil) != (wp.err == nil) {
+				t.Errorf("round %d page %d err = %v, want %v", i, j, gp.err, wp.err)
+			}
+		}
+	}
+	if msg := got[1].pages[0].err.Error(); msg != "fetch metrics: status 503 Service Unavailable" {
+		t.Errorf("error entry read back as %q, want it on one line", msg)
+	}
+}
+
+func TestRecordingFixture(t *testing.T) {
+	targets, err := RecordedTargets(sessionFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http://host1:9100/metrics", "http://host2:9100/metrics"}
+	if !slices.Equal(targets, want) {
+		t.Errorf("RecordedTargets = %v, want %v", targets, want)
+	}
+
+	rounds := readRounds(t, sessionFixture)
+	if len(rounds) != 3 {
+		t.Fatalf("read %d rounds, want 3", len(rounds))
+	}
+	if got := rounds[2].time.Sub(rounds[0].time); got != 30*time.Second {
+		t.Errorf("rounds span %s, want 30s", got)
+	}
+	if ct := rounds[0].pages[0].contentType; ct != "text/plain; version=0.0.4" {
+		t.Errorf("host1 content type = %q", ct)
+	}
+	if ct := rounds[0].pages[1].contentType; ct != "" {
+		t.Errorf("host2 content type = %q, want none (older recording format)", ct)
+	}
+	if rounds[1].pages[1].err == nil {
+		t.Error("host2's failed scrape in round 2 was not read back as an error")
+	}
+}
+
+func TestRecordingCutShort(t *testing.T) {
+	data, err := os.ReadFile(sessionFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last round is the file's last 137 bytes
+	tests := []struct {
+		name      string
+		cut       int // bytes dropped from the end
+		rounds    int
+		lastPages int // pages read from the last round
+	}{
+		{name: "whole", cut: 0, rounds: 3, lastPages: 2},
+		{name: "last page cut short", cut: 20, rounds: 3, lastPages: 1},
+		{name: "last round barely started", cut: 130, rounds: 2, lastPages: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cut.rec")
+			if err := os.WriteFile(path, data[:len(data)-tt.cut], 0o644); err != nil {
+				t.Fatal(err)
+			}
+			rounds := readRounds(t, path)
+			if len(rounds) != tt.rounds {
+				t.Fatalf("read %d rounds, want %d", len(rounds), tt.rounds)
+			}
+			if got := len(rounds[len(rounds)-1].pages); got != tt.lastPages {
+				t.Errorf("last round has %d pages, want %d", got, tt.lastPages)
+			}
+		})
+	}
+}
+
+func TestRecordedTargetsErrors(t *testing.T) {
+	dir := t.TempDir()
+	notGzip := filepath.Join(dir, "plain.txt")
+	os.WriteFile(notGzip, []byte("up 1\n"), 0o644)
+	empty := filepath.Join(dir, "empty.rec")
+	rec, err := NewRecorder(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.record(time.Now(), nil) // a round with no pages
+	rec.Close()
+
+	for _, path := range []string{filepath.Join(dir, "missing.rec"), notGzip, empty} {
+		if _, err := RecordedTargets(path); err == nil {
+			t.Errorf("RecordedTargets(%s) = nil error", filepath.Base(path))
+		}
+	}
+}
+
+// readRounds reads every round of a recording
+func readRounds(t *testing.T, path string) []round {
+	t.Helper()
+	rr, err := openRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Close()
+	var rounds []round
+	for {
+		rd, err := rr.next()
+		if err == io.EOF {
+			return rounds
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rounds = append(rounds, rd)
+	}
+}
@@ -0,0 +1,163 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+func init() {
+	RegisterSource("replay", newReplaySource)
+}
+
+// replaySource plays a recording (see Recorder) back through the same parsing and expressions as
+// a live scrape; batches carry the recorded times, so rates and the x-axis come out as they did
+type replaySource struct {
+	path   string
+	title  string
+	only   map[string]bool // targets to replay; nil replays all
+	multi  bool            // several targets are replayed: label every series with its instance
+	speed  float64
+	reader *scrapeReader
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newReplaySource replays the recording at cfg.URL, cfg.Speed times faster than it was recorded
+// (as fast as possible when 0). cfg.Targets limits it to some of the recorded targets.
+func newReplaySource(cfg SourceConfig) (Source, error) {
+	targets, err := RecordedTargets(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	r := &replaySource{path: cfg.URL, speed: cfg.Speed, done: make(chan struct{})}
+	if len(cfg.Targets) > 0 {
+		r.only = map[string]bool{}
+		var kept []string
+		for _, t := range NormalizeTargets(cfg.Targets) {
+			r.only[t] = true
+		}
+		for _, t := range targets {
+			if r.only[t] {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == 0 {
+			return nil, fmt.Errorf("%s: none of the targets were recorded", cfg.URL)
+		}
+		targets = kept
+	}
+	if r.reader, err = newScrapeReader(cfg.Exprs); err != nil {
+		return nil, err
+	}
+	r.multi = len(targets) > 1
+	r.title = "Replay: " + r.reader.title(len(targets))
+	return r, nil
+}
+
+func (r *replaySource) Title() string {
+	return r.title
+}
+
+// Done is closed when the whole recording has been replayed (or the replay was stopped)
+func (r *replaySource) Done() <-chan struct{} {
+	return r.done
+}
+
+// Start replays the recording on its own goroutine, waiting between batches as long as the
+// recording did (divided by the speed). A batch is a run of rounds covering each target once:
+// one round of a multi-target scrape, or the rounds of the widgets a --split-targets session
+// recorded separately, so every target's series carry on from batch to batch either way.
+func (r *replaySource) Start(out chan<- Batch) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go func() {
+		defer close(r.done)
+		send := func(batch Batch) bool {
+			batch.Source = r
+			select {
+			case out <- batch:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		rec, err := openRecording(r.path)
+		if err != nil {
+			send(Batch{Time: time.Now(), Err: err})
+			return
+		}
+		defer rec.Close()
+		var last time.Time
+		var group []page             // rounds read but not sent yet
+		var groupTime time.Time      // when the first of them was recorded
+		inGroup := map[string]bool{} // their targets
+		// flush sends the group, after waiting as long as the recording did since the last one
+		flush := func() bool {
+			if len(group) == 0 {
+				return true
+			}
+			if !last.IsZero() && r.speed > 0 {
+				select {
+				case <-time.After(time.Duration(float64(groupTime.Sub(last)) / r.speed)):
+				case <-ctx.Done():
+					return false
+				}
+			}
+			last = groupTime
+			exp, err := parseTargets(group, r.multi)
+			group, inGroup = nil, map[string]bool{}
+			return send(r.reader.batch(last, exp, err))
+		}
+		for {
+			rd, err := rec.next()
+			if err == io.EOF {
+				flush()
+				return
+			}
+			if err != nil {
+				if flush() {
+					send(Batch{Time: time.Now(), Err: err})
+				}
+				return
+			}
+			pages := rd.pages
+			if r.only != nil {
+				pages = nil
+				for _, p := range rd.pages {
+					if r.only[p.target] {
+						pages = append(pages, p)
+					}
+				}
+				if len(pages) == 0 {
+					continue
+				}
+			}
+			for _, p := range pages {
+				if inGroup[p.target] {
+					// a target comes round again: the group is complete
+					if !flush() {
+						return
+					}
+					break
+				}
+			}
+			if len(group) == 0 {
+				groupTime = rd.time
+			}
+			for _, p := range pages {
+				group = append(group, p)
+				inGroup[p.target] = true
+			}
+		}
+	}()
+}
+
+// Stop ends the replay
+func (r *replaySource) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
@@ -0,0 +1,194 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplaySource(t *testing.T) {
+	nan := math.NaN()
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		cfg     SourceConfig
+		title   string
+		batches []map[string]float64 // series => value, one map per batch
+		errs    []string             // per batch: "" or a part of the error
+	}{
+		{
+			name:  "rate across targets",
+			cfg:   SourceConfig{Exprs: []string{"rate(req_total[1m])"}},
+			title: "Replay: Metrics (2 targets)",
+			batches: []map[string]float64{
+				{`req_total{code="200",instance="host1:9100"}`: nan, `req_total{code="200",instance="host2:9100"}`: nan},
+				{`req_total{code="200",instance="host1:9100"}`: 10},
+				// host2 missed a scrape, so its rate starts over
+				{`req_total{code="200",instance="host1:9100"}`: 10, `req_total{code="200",instance="host2:9100"}`: nan},
+			},
+			errs: []string{"", "host2:9100: fetch metrics: timed out", ""},
+		},
+		{
+			name:  "one target",
+			cfg:   SourceConfig{Exprs: []string{"up"}, Targets: []string{"host2:9100"}},
+			title: "Replay: Metrics",
+			batches: []map[string]float64{
+				{"up": 1},
+				{},
+				{"up": 0},
+			},
+			errs: []string{"", "timed out after 10s", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.URL, tt.cfg.Interval = sessionFixture, time.Second
+			src, err := NewSource("replay", tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src.Title() != tt.title {
+				t.Errorf("title = %q, want %q", src.Title(), tt.title)
+			}
+			batches := replayAll(t, src)
+			if len(batches) != len(tt.batches) {
+				t.Fatalf("got %d batches, want %d", len(batches), len(tt.batches))
+			}
+			for i, batch := range batches {
+				if want := t0.Add(time.Duration(i) * 15 * time.Second); !batch.Time.Equal(want) {
+					t.Errorf("batch %d at %v, want the recorded %v", i, batch.Time, want)
+				}
+				if tt.errs[i] == "" && batch.Err != nil || tt.errs[i] != "" && (batch.Err == nil || !strings.Contains(batch.Err.Error(), tt.errs[i])) {
+					t.Errorf("batch %d err = %v, want %q", i, batch.Err, tt.errs[i])
+				}
+				got := map[string]float64{}
+				for _, r := range batch.Readings {
+					got[r.Sample.String()] = r.Value
+				}
+				if len(got) != len(tt.batches[i]) {
+					t.Errorf("batch %d = %v, want %v", i, got, tt.batches[i])
+					continue
+				}
+				for series, want := range tt.batches[i] {
+					if v, ok := got[series]; !ok || !sameValue(v, want) {
+						t.Errorf("batch %d: %s = %v, want %v", i, series, v, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReplaySplitTargets(t *testing.T) {
+	// --split-targets records each widget's scrape as a round of its own, a moment apart
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "split.rec")
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, values := range [][2]int{{100, 50}, {250, 200}, {400, 350}} {
+		at := t0.Add(time.Duration(i) * 15 * time.Second)
+		for j, target := range []string{"http://host1:9100/metrics", "http://host2:9100/metrics"} {
+			body := fmt.Sprintf("req_total %d\n", values[j])
+			if err := rec.record(at.Add(time.Duration(j)*time.Second), []page{{target: target, body: []byte(body)}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	rec.Close()
+
+	nan := math.NaN()
+	tests := []struct {
+		name    string
+		targets []string
+		batches []map[string]float64
+	}{
+		{
+			name: "every target",
+			batches: []map[string]float64{
+				{`req_total{instance="host1:9100"}`: nan, `req_total{instance="host2:9100"}`: nan},
+				{`req_total{instance="host1:9100"}`: 10, `req_total{instance="host2:9100"}`: 10},
+				{`req_total{instance="host1:9100"}`: 10, `req_total{instance="host2:9100"}`: 10},
+			},
+		},
+		{
+			name:    "one target",
+			targets: []string{"host2:9100"},
+			batches: []map[string]float64{{"req_total": nan}, {"req_total": 10}, {"req_total": 10}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := NewSource("replay", SourceConfig{URL: path, Targets: tt.targets, Exprs: []string{"rate(req_total[1m])"}, Interval: time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			batches := replayAll(t, src)
+			if len(batches) != len(tt.batches) {
+				t.Fatalf("got %d batches, want %d", len(batches), len(tt.batches))
+			}
+			for i, batch := range batches {
+				if batch.Err != nil {
+					t.Errorf("batch %d: %v", i, batch.Err)
+				}
+				got := map[string]float64{}
+				for _, r := range batch.Readings {
+					got[r.Sample.String()] = r.Value
+				}
+				if len(got) != len(tt.batches[i]) {
+					t.Errorf("batch %d = %v, want %v", i, got, tt.batches[i])
+					continue
+				}
+				for series, want := range tt.batches[i] {
+					if v, ok := got[series]; !ok || !sameValue(v, want) {
+						t.Errorf("batch %d: %s = %v, want %v", i, series, v, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReplaySourceErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  SourceConfig
+	}{
+		{name: "missing file", cfg: SourceConfig{URL: "testdata/missing.rec"}},
+		{name: "target not recorded", cfg: SourceConfig{URL: sessionFixture, Targets: []string{"host3:9100"}}},
+		{name: "bad expression", cfg: SourceConfig{URL: sessionFixture, Exprs: []string{"rate(up"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Interval = time.Second
+			if _, err := NewSource("replay", tt.cfg); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// replayAll starts a replay and collects its batches until it is done
+func replayAll(t *testing.T, src Source) []Batch {
+	t.Helper()
+	out := make(chan Batch)
+	src.Start(out)
+	defer src.Stop()
+	done := src.(Finite).Done()
+	var batches []Batch
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case batch := <-out:
+			batches = append(batches, batch)
+		case <-done:
+			return batches
+		case <-timeout:
+			t.Fatal("replay didn't finish")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+func init() {
+	RegisterSource("prometheus", newScrapeSource)
+}
+
+// newScrapeSource scrapes a Prometheus/OpenMetrics page every interval: the series matched by
+// the --metric expressions, or windows_cpu_core_frequency_mhz per core when there are none.
+// With several targets they are scraped concurrently and every series gets an instance label.
+// A scrape is abandoned after cfg.Timeout, or after the interval (at most DefaultScrapeTimeout).
+// Every scrape is appended to cfg.Recorder when set.
+func newScrapeSource(cfg SourceConfig) (Source, error) {
+	targets := NormalizeTargets(append([]string{cfg.URL}, cfg.Targets...))
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("prometheus source: no metrics URL")
+	}
+	httpCfg := cfg.HTTP
+	if httpCfg.Timeout <= 0 {
+		httpCfg.Timeout = cfg.Timeout
+	}
+	if httpCfg.Timeout <= 0 {
+		httpCfg.Timeout = min(cfg.Interval, DefaultScrapeTimeout)
+	}
+	scraper, err := NewScraper(httpCfg)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newScrapeReader(cfg.Exprs)
+	if err != nil {
+		return nil, err
+	}
+	p := newPoller(reader.title(len(targets)), cfg.Interval, func(ctx context.Context) Batch {
+		now := time.Now()
+		pages := scraper.fetchTargets(ctx, targets)
+		exp, err := parseTargets(pages, false)
+		batch := reader.batch(now, exp, err)
+		// a scrape cut short by Stop isn't worth keeping
+		if cfg.Recorder != nil && ctx.Err() == nil {
+			if err := cfg.Recorder.record(now, pages); err != nil && batch.Err == nil {
+				batch.Err = err
+			}
+		}
+		return batch
+	})
+	p.busy = "scraping…"
+	return p, nil
+}
+
+// scrapeReader turns scraped pages into batches: the series the expressions select (through an
+// Evaluator, which keeps rate()/increase() state between scrapes), or the CPU frequency per core
+// when there are no expressions. Live scrapes and replays share it.
+type scrapeReader struct {
+	selectors []*Selector
+	evaluator *Evaluator
+}
+
+// newScrapeReader parses the expressions
+func newScrapeReader(exprs []string) (*scrapeReader, error) {
+	if len(exprs) == 0 {
+		return &scrapeReader{}, nil
+	}
+	selectors, err := parseSelectors(exprs)
+	if err != nil {
+		return nil, err
+	}
+	evaluator, err := NewEvaluator(exprs)
+	if err != nil {
+		return nil, err
+	}
+	return &scrapeReader{selectors: selectors, evaluator: evaluator}, nil
+}
+
+// title describes what is collected from the given number of targets
+func (r *scrapeReader) title(targets int) string {
+	title := "Metrics"
+	if r.evaluator == nil {
+		title = "CPU frequency MHz"
+	}
+	if targets > 1 {
+		title += fmt.Sprintf(" (%d targets)", targets)
+	}
+	return title
+}
+
+// batch reads a scraped exposition taken at now; err is the scrape's error, which comes with an
+// exposition when only some targets failed
+func (r *scrapeReader) batch(now time.Time, exp *Exposition, err error) Batch {
+	if exp == nil {
+		return Batch{Time: now, Err: err}
+	}
+	if r.evaluator == nil {
+		batch := cpuFrequencyBatch(now, exp)
+		batch.Err = err
+		return batch
+	}
+	snapshot := selectSeries(now, exp, r.selectors)
+	r.evaluator.Apply(snapshot)
+	batch := Batch{Time: snapshot.Time, Readings: make([]Reading, len(snapshot.Series)), Err: err}
+	for i, series := range snapshot.Series {
+		batch.Readings[i] = Reading{Key: series.Key(), Group: r.evaluator.Legend(series.Selector), Sample: series.Sample}
+	}
+	return batch
+}
+
+// cpuFrequencyBatch picks windows_cpu_core_frequency_mhz from a scrape, one reading per tracked
+// core (and instance, when several targets were scraped)
+func cpuFrequencyBatch(now time.Time, exp *Exposition) Batch {
+	batch := Batch{Time: now}
+	for _, sample := range exp.Samples {
+		if sample.Name != "windows_cpu_core_frequency_mhz" || !slices.Contains(coresToTrack, sample.Labels["core"]) {
+			continue
+		}
+		batch.Readings = append(batch.Readings, Reading{Key: sample.String(), Group: sample.Name, Sample: sample})
+	}
+	return batch
+}
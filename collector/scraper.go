@@ -0,0 +1,274 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acceptHeader asks for OpenMetrics first and falls back to the Prometheus text format
+// (the same preference order Prometheus itself sends)
+const acceptHeader = "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75," +
+	"text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+
+// DefaultScrapeTimeout limits a scrape when ScrapeConfig.Timeout isn't set
+const DefaultScrapeTimeout = 10 * time.Second
+
+// ScrapeConfig configures how metrics pages are fetched: timeout, authentication and TLS
+type ScrapeConfig struct {
+	Timeout time.Duration // per request; 0 uses DefaultScrapeTimeout
+
+	BearerToken     string // sent as "Authorization: Bearer <token>"
+	BearerTokenFile string // read on every scrape, so rotated tokens are picked up
+	Username        string // basic auth (used when set)
+	Password        string
+
+	CAFile             string // PEM bundle to verify the server with, instead of the system roots
+	CertFile           string // client certificate (PEM) for mutual TLS, with KeyFile
+	KeyFile            string
+	InsecureSkipVerify bool // don't verify the server certificate
+}
+
+// identity is what decides whether two scrapers may share a request (and a client): every
+// setting but the timeout, hashed so credentials don't sit in map keys in the clear
+func (cfg ScrapeConfig) identity() [sha256.Size]byte {
+	cfg.Timeout = 0
+	return sha256.Sum256(fmt.Appendf(nil, "%#v", cfg))
+}
+
+// Scraper fetches and parses metrics pages. One Scraper is safe for concurrent use and reuses
+// connections between scrapes.
+type Scraper struct {
+	client *http.Client
+	cfg    ScrapeConfig
+	id     [sha256.Size]byte // cfg.identity()
+}
+
+// DefaultScraper is used by FetchCPUFrequency and FetchGenericMetrics
+var DefaultScraper = NewScraperWithClient(&http.Client{}, ScrapeConfig{})
+
+var (
+	clientsMu sync.Mutex
+	clients   = map[[sha256.Size]byte]*http.Client{} // by ScrapeConfig.identity
+)
+
+// NewScraper creates a scraper, loading the CA bundle and client certificate if configured.
+// Scrapers with the same settings (the timeout aside) share one client, so sources scraping the
+// same target with them share connections and requests in flight (see Fetch).
+func NewScraper(cfg ScrapeConfig) (*Scraper, error) {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate needs both a cert file and a key file")
+	}
+	if cfg.BearerToken != "" && cfg.BearerTokenFile != "" {
+		return nil, fmt.Errorf("set a bearer token or a bearer token file, not both")
+	}
+	if cfg.Username != "" && (cfg.BearerToken != "" || cfg.BearerTokenFile != "") {
+		return nil, fmt.Errorf("set basic auth or a bearer token, not both")
+	}
+	id := cfg.identity()
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if client, ok := clients[id]; ok {
+		return &Scraper{client: client, cfg: cfg, id: id}, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// we ask for gzip ourselves (below), so the transport must not decode it behind our back
+	transport.DisableCompression = true
+	if cfg.CAFile != "" || cfg.CertFile != "" || cfg.InsecureSkipVerify {
+		tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("CA file %s: no PEM certificates found", cfg.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if cfg.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	client := &http.Client{Transport: transport}
+	clients[id] = client
+	return &Scraper{client: client, cfg: cfg, id: id}, nil
+}
+
+// NewScraperWithClient creates a scraper using an existing HTTP client (e.g. an httptest
+// server's Client()); auth settings in cfg still apply, its TLS settings don't
+func NewScraperWithClient(client *http.Client, cfg ScrapeConfig) *Scraper {
+	return &Scraper{client: client, cfg: cfg, id: cfg.identity()}
+}
+
+// Scrape fetches a metrics page (e.g. http://localhost:9182/metrics) and parses it, giving up
+// after the configured timeout or when ctx is done
+func (s *Scraper) Scrape(ctx context.Context, metricsURL string) (*Exposition, error) {
+	body, contentType, err := s.Fetch(ctx, metricsURL)
+	if err != nil {
+		return nil, err
+	}
+	return parsePage(body, contentType)
+}
+
+// flight is a fetch in progress that callers wanting the same page wait for
+type flight struct {
+	done        chan struct{} // closed when body, contentType and err are set
+	body        []byte
+	contentType string
+	err         error
+}
+
+// flightKey identifies a page fetched with one client and one set of credentials: only callers
+// that would send the same request share it
+type flightKey struct {
+	client *http.Client
+	id     [sha256.Size]byte
+	url    string
+}
+
+var (
+	flightsMu sync.Mutex
+	flights   = map[flightKey]*flight{} // the fetches in progress
+)
+
+// Fetch downloads a metrics page without parsing it (gzip already decoded) and returns it with
+// its Content-Type (see ParseExposition), giving up after the configured timeout or when ctx is
+// done. A target has at most one request in flight: fetching a page that a scraper with the same
+// client and settings (e.g. another widget's) is already fetching waits for that request instead
+// of sending a second one, for at most this scraper's timeout.
+func (s *Scraper) Fetch(ctx context.Context, metricsURL string) ([]byte, string, error) {
+	key := flightKey{s.client, s.id, metricsURL}
+	flightsMu.Lock()
+	f, ok := flights[key]
+	if !ok {
+		f = &flight{done: make(chan struct{})}
+		flights[key] = f
+		// the request serves every caller, so one caller giving up doesn't cancel it (the timeout still applies)
+		go func() {
+			f.body, f.contentType, f.err = s.fetch(context.WithoutCancel(ctx), metricsURL)
+			flightsMu.Lock()
+			delete(flights, key)
+			flightsMu.Unlock()
+			close(f.done)
+		}()
+	}
+	flightsMu.Unlock()
+	timeout := s.timeout()
+	wait := time.NewTimer(timeout)
+	defer wait.Stop()
+	select {
+	case <-f.done:
+		return f.body, f.contentType, f.err
+	case <-wait.C:
+		return nil, "", fmt.Errorf("fetch metrics: timed out after %s", timeout)
+	case <-ctx.Done():
+		return nil, "", fmt.Errorf("fetch metrics: %w", ctx.Err())
+	}
+}
+
+// timeout is how long a fetch may take
+func (s *Scraper) timeout() time.Duration {
+	if s.cfg.Timeout <= 0 {
+		return DefaultScrapeTimeout
+	}
+	return s.cfg.Timeout
+}
+
+// fetch sends the request for Fetch
+func (s *Scraper) fetch(ctx context.Context, metricsURL string) ([]byte, string, error) {
+	timeout := s.timeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metricsURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch metrics: %w", err)
+	}
+	req.Header.Set("Accept", acceptHeader)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if err := s.authorize(req); err != nil {
+		return nil, "", err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, "", fmt.Errorf("fetch metrics: timed out after %s", timeout)
+		}
+		return nil, "", fmt.Errorf("fetch metrics: %w", err)
+	}
+	// ensure we close the body when we're done so we don't leak connections
+	defer resp.Body.Close()
+	// only accept 200 OK; otherwise body might be an error page
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetch metrics: status %s", resp.Status)
+	}
+
+	data, err := readBody(resp)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, "", fmt.Errorf("fetch metrics: timed out after %s", timeout)
+		}
+		return nil, "", fmt.Errorf("fetch metrics: %w", err)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// readBody reads a response body, decoding gzip when the server sent it
+func readBody(resp *http.Response) ([]byte, error) {
+	var body io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	return io.ReadAll(body)
+}
+
+// parsePage parses a fetched metrics page in the format its Content-Type names
+func parsePage(body []byte, contentType string) (*Exposition, error) {
+	exp, err := ParseExposition(bytes.NewReader(body), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("parse metrics: %w", err)
+	}
+	return exp, nil
+}
+
+// authorize adds the bearer token or basic auth credentials
+func (s *Scraper) authorize(req *http.Request) error {
+	token := s.cfg.BearerToken
+	if s.cfg.BearerTokenFile != "" {
+		data, err := os.ReadFile(s.cfg.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("read bearer token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case s.cfg.Username != "":
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+	return nil
+}
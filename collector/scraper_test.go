@@ -0,0 +1,311 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testPage = "# TYPE up gauge\nup 1\n"
+
+func TestFetch(t *testing.T) {
+	gzipped := func() []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(testPage))
+		gz.Close()
+		return buf.Bytes()
+	}()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     ScrapeConfig
+		handler http.HandlerFunc
+		want    string // page body; "" when an error is expected
+		wantErr string
+	}{
+		{
+			name: "plain",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if !strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+					t.Errorf("Accept = %q, want OpenMetrics first", r.Header.Get("Accept"))
+				}
+				w.Write([]byte(testPage))
+			},
+			want: testPage,
+		},
+		{
+			name: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Accept-Encoding") != "gzip" {
+					t.Errorf("Accept-Encoding = %q, want gzip", r.Header.Get("Accept-Encoding"))
+				}
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Write(gzipped)
+			},
+			want: testPage,
+		},
+		{
+			name: "bearer token",
+			cfg:  ScrapeConfig{BearerToken: "s3cret"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer s3cret" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(testPage))
+			},
+			want: testPage,
+		},
+		{
+			name: "bearer token file",
+			cfg:  ScrapeConfig{BearerTokenFile: tokenFile},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer from-file" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(testPage))
+			},
+			want: testPage,
+		},
+		{
+			name: "basic auth",
+			cfg:  ScrapeConfig{Username: "prom", Password: "pw"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if user, pass, ok := r.BasicAuth(); !ok || user != "prom" || pass != "pw" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(testPage))
+			},
+			want: testPage,
+		},
+		{
+			name: "wrong credentials",
+			cfg:  ScrapeConfig{Username: "prom", Password: "wrong"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			},
+			wantErr: "status 401",
+		},
+		{
+			name: "timeout",
+			cfg:  ScrapeConfig{Timeout: 50 * time.Millisecond},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(2 * time.Second):
+				case <-r.Context().Done():
+				}
+			},
+			wantErr: "timed out after 50ms",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			scraper, err := NewScraper(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _, err := scraper.Fetch(context.Background(), server.URL+"/metrics")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.want {
+				t.Errorf("body = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(testPage))
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // the rejected handshake is expected
+	server.StartTLS()
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     ScrapeConfig
+		wantErr bool
+	}{
+		{name: "unknown CA", wantErr: true},
+		{name: "CA file", cfg: ScrapeConfig{CAFile: caFile}},
+		{name: "insecure skip verify", cfg: ScrapeConfig{InsecureSkipVerify: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scraper, err := NewScraper(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, contentType, err := scraper.Fetch(context.Background(), server.URL+"/metrics")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected a certificate error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != testPage || contentType != "text/plain; version=0.0.4" {
+				t.Errorf("got %q (%s), want %q (text/plain; version=0.0.4)", body, contentType, testPage)
+			}
+		})
+	}
+}
+
+func TestNewScraperRejectsConflictingAuth(t *testing.T) {
+	tests := []ScrapeConfig{
+		{BearerToken: "a", BearerTokenFile: "b"},
+		{Username: "u", BearerToken: "a"},
+		{CertFile: "cert.pem"},
+		{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+	}
+	for _, cfg := range tests {
+		if _, err := NewScraper(cfg); err == nil {
+			t.Errorf("NewScraper(%+v) = nil error", cfg)
+		}
+	}
+}
+
+func TestFetchSharesRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		scrapers func(client *http.Client) []*Scraper // one concurrent Fetch each
+		want     int32                                // requests the server sees
+	}{
+		{
+			name: "same scraper",
+			scrapers: func(client *http.Client) []*Scraper {
+				s := NewScraperWithClient(client, ScrapeConfig{})
+				return []*Scraper{s, s, s}
+			},
+			want: 1,
+		},
+		{
+			name: "scrapers with other credentials",
+			scrapers: func(client *http.Client) []*Scraper {
+				return []*Scraper{
+					NewScraperWithClient(client, ScrapeConfig{Username: "a", Password: "1"}),
+					NewScraperWithClient(client, ScrapeConfig{Username: "b", Password: "2"}),
+				}
+			},
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				<-release
+				w.Write([]byte(testPage))
+			}))
+			defer server.Close()
+
+			var wg sync.WaitGroup
+			for _, s := range tt.scrapers(server.Client()) {
+				wg.Go(func() {
+					if body, _, err := s.Fetch(context.Background(), server.URL+"/metrics"); err != nil || string(body) != testPage {
+						t.Errorf("Fetch = %q, %v", body, err)
+					}
+				})
+			}
+			// answer once every Fetch has had time to send its request or join one
+			for deadline := time.Now().Add(time.Second); requests.Load() < tt.want && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			if got := requests.Load(); got != tt.want {
+				t.Errorf("%d requests, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourcesShareRequests(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Write([]byte(testPage))
+	}))
+	defer server.Close()
+
+	// two widgets on the same target (at other intervals) and one scraping it as someone else
+	configs := []SourceConfig{
+		{URL: server.URL, Exprs: []string{"up"}, Interval: time.Minute},
+		{URL: server.URL, Exprs: []string{"up"}, Interval: 30 * time.Second},
+		{URL: server.URL, Exprs: []string{"up"}, Interval: time.Minute, HTTP: ScrapeConfig{BearerToken: "other"}},
+	}
+	batches := make(chan Batch)
+	for _, cfg := range configs {
+		src, err := NewSource("prometheus", cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src.Start(batches)
+		defer src.Stop()
+	}
+	for deadline := time.Now().Add(time.Second); requests.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond) // the second widget's scrape has joined the first one's by now
+	close(release)
+
+	for done := 0; done < len(configs); {
+		select {
+		case batch := <-batches:
+			if batch.Busy != "" {
+				continue // a slow machine may call the wait long
+			}
+			done++
+			if batch.Err != nil || len(batch.Readings) != 1 {
+				t.Errorf("batch = %d readings, %v; want up", len(batch.Readings), batch.Err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("a source didn't send its scrape")
+		}
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("%d requests, want 2 (one shared by the widgets with the same settings)", got)
+	}
+}
@@ -0,0 +1,199 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MatchOp is a label matching operator
+type MatchOp string
+
+const (
+	MatchEqual     MatchOp = "="
+	MatchNotEqual  MatchOp = "!="
+	MatchRegexp    MatchOp = "=~"
+	MatchNotRegexp MatchOp = "!~"
+)
+
+// LabelMatcher is one name<op>"value" term of a selector
+type LabelMatcher struct {
+	Name  string
+	Op    MatchOp
+	Value string
+	re    *regexp.Regexp // for =~ and !~, anchored like PromQL
+}
+
+// Matches reports whether a label value ("" when the label is absent) satisfies the matcher
+func (m LabelMatcher) Matches(value string) bool {
+	switch m.Op {
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return value == m.Value
+}
+
+// Selector picks series out of a scrape with PromQL-style matchers, e.g.
+// windows_cpu_time_total{mode=~"user|system",core!="0,0"}. Like PromQL, a selector matches every
+// series whose labels satisfy all matchers (a missing label counts as ""), so one selector can
+// expand into several series; the metric name may also be given as {__name__=~"..."}.
+type Selector struct {
+	Name     string // "" when the name comes from a __name__ matcher
+	Matchers []LabelMatcher
+	text     string
+}
+
+// ParseSelector parses name, name{matchers} or {matchers}; matchers are label="v", label!="v",
+// label=~"regex" and label!~"regex", separated by commas
+func ParseSelector(s string) (*Selector, error) {
+	text := strings.TrimSpace(s)
+	p := &lineParser{src: text}
+	sel := &Selector{Name: p.name(), text: text}
+	p.skipSpace()
+	if p.peek() == '{' {
+		matchers, err := p.matchers()
+		if err != nil {
+			return nil, fmt.Errorf("selector %q: %w", s, err)
+		}
+		sel.Matchers = matchers
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("selector %q: unexpected %q", s, p.src[p.pos:])
+	}
+	if sel.Name == "" && len(sel.Matchers) == 0 {
+		return nil, fmt.Errorf("selector %q: expected metric name or {matchers}", s)
+	}
+	return sel, nil
+}
+
+// matchers reads {label op "value", ...} (a trailing comma is allowed)
+func (p *lineParser) matchers() ([]LabelMatcher, error) {
+	p.pos++ // {
+	var matchers []LabelMatcher
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			return matchers, nil
+		}
+		name := p.name()
+		if name == "" {
+			return nil, fmt.Errorf("expected label name at offset %d", p.pos)
+		}
+		p.skipSpace()
+		m := LabelMatcher{Name: name}
+		for _, op := range []MatchOp{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+			if strings.HasPrefix(p.src[p.pos:], string(op)) {
+				m.Op = op
+				p.pos += len(op)
+				break
+			}
+		}
+		if m.Op == "" {
+			return nil, fmt.Errorf("expected =, !=, =~ or !~ after label %s", name)
+		}
+		p.skipSpace()
+		value, err := p.quoted()
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %w", name, err)
+		}
+		m.Value = value
+		if m.Op == MatchRegexp || m.Op == MatchNotRegexp {
+			if m.re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+				return nil, fmt.Errorf("label %s: %w", name, err)
+			}
+		}
+		matchers = append(matchers, m)
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		default:
+			return nil, fmt.Errorf("expected , or } after label %s", name)
+		}
+	}
+}
+
+// String returns the selector as written
+func (s *Selector) String() string {
+	return s.text
+}
+
+// Matches reports whether sample has the selector's name and satisfies every matcher
+func (s *Selector) Matches(sample Sample) bool {
+	if s.Name != "" && sample.Name != s.Name {
+		return false
+	}
+	for _, m := range s.Matchers {
+		value := sample.Labels[m.Name]
+		if m.Name == "__name__" {
+			value = sample.Name
+		}
+		if !m.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns every sample in the scrape matching the selector, in page order
+func (s *Selector) Select(exp *Exposition) []Sample {
+	var out []Sample
+	for _, sample := range exp.Samples {
+		if s.Matches(sample) {
+			out = append(out, sample)
+		}
+	}
+	return out
+}
+
+// Legends labels series matched by one selector by what tells them apart: the labels whose
+// values differ (e.g. {mode="user"} vs {mode="system"}), plus the metric name when names differ.
+// A single series, or one that nothing distinguishes, is labelled with fallback (the selector).
+func Legends(series []Sample, fallback string) []string {
+	legends := make([]string, len(series))
+	if len(series) == 0 {
+		return legends
+	}
+	namesDiffer := false
+	varying := map[string]bool{}
+	for _, s := range series {
+		if s.Name != series[0].Name {
+			namesDiffer = true
+		}
+		for k, v := range s.Labels {
+			if series[0].Labels[k] != v {
+				varying[k] = true
+			}
+		}
+		for k, v := range series[0].Labels {
+			if s.Labels[k] != v {
+				varying[k] = true
+			}
+		}
+	}
+
+	for i, s := range series {
+		labels := map[string]string{}
+		for k := range varying {
+			if v, ok := s.Labels[k]; ok {
+				labels[k] = v
+			}
+		}
+		name := ""
+		if namesDiffer {
+			name = s.Name
+		}
+		legends[i] = FormatSeries(name, labels)
+		if legends[i] == "" {
+			legends[i] = fallback
+		}
+	}
+	return legends
+}
@@ -0,0 +1,190 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source is a live input: once started it collects in the background and sends a Batch on the
+// channel every interval (the first one right away) until it is stopped. Widgets don't care
+// what kind of source feeds them; they only see batches of timestamped samples.
+type Source interface {
+	// Start begins collecting; batches are sent to out until Stop is called
+	Start(out chan<- Batch)
+	// Stop ends collection; a collection in progress finishes in the background and is dropped
+	Stop()
+	// Title describes what the source collects, used as the default widget title
+	Title() string
+}
+
+// Finite is implemented by sources that run out, like replays: Done is closed once the last
+// batch has been sent
+type Finite interface {
+	Done() <-chan struct{}
+}
+
+// Batch is what a source collected at one point in time
+type Batch struct {
+	Source   Source // the source that sent it (several can share one channel)
+	Time     time.Time
+	Readings []Reading
+	Err      error  // set when this collection failed; Readings is then empty, unless only part of it failed (some targets of a multi-target source, some statsd lines)
+	Busy     string // instead of a result: the collection started at Time is taking long, doing this (e.g. "scraping…")
+	More     bool   // more batches from the same collection follow right away (a backfill sends one per past point)
+}
+
+// Reading is one series' value in a batch
+type Reading struct {
+	Key   string // identifies the series across batches
+	Group string // series from the same query; a lone series is labelled with it (see Legends)
+	Sample
+}
+
+// SourceConfig holds the options a source is created from (command-line flags or a dashboard source)
+type SourceConfig struct {
+	URL      string        // endpoint to read from (e.g. a /metrics page)
+	Targets  []string      // more endpoints scraped along with URL; their series get an instance label
+	Exprs    []string      // what to collect from it (e.g. --metric expressions)
+	Command  string        // shell command to run (exec sources)
+	Pattern  string        // regex pulling fields out of the command's output (exec sources)
+	Interval time.Duration // time between collections
+	Timeout  time.Duration // limit for one collection; 0 uses Interval (capped at DefaultScrapeTimeout for scrapes)
+	HTTP     ScrapeConfig  // auth and TLS for sources that fetch over HTTP
+	Recorder *Recorder     // scrape sources append every raw scrape to it (nil: don't record)
+	Speed    float64       // replay sources: times faster than recorded; 0 replays as fast as possible
+	Root     string        // system sources: directory holding proc and sys ("" is /)
+	Range    time.Duration // sources that can load past data (promql) start this far back
+}
+
+// SourceFactory creates a source of one kind
+type SourceFactory func(cfg SourceConfig) (Source, error)
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = map[string]SourceFactory{}
+)
+
+// RegisterSource makes a source kind available to NewSource; kinds register themselves in init
+func RegisterSource(kind string, factory SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if _, dup := sources[kind]; dup {
+		panic("collector: source kind registered twice: " + kind)
+	}
+	sources[kind] = factory
+}
+
+// NewSource creates a source of a registered kind
+func NewSource(kind string, cfg SourceConfig) (Source, error) {
+	sourcesMu.RLock()
+	factory, ok := sources[kind]
+	sourcesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source kind %q (available: %s)", kind, strings.Join(SourceKinds(), ", "))
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("source %s: interval must be positive", kind)
+	}
+	return factory(cfg)
+}
+
+// SourceKinds lists the registered source kinds, sorted
+func SourceKinds() []string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	kinds := make([]string, 0, len(sources))
+	for kind := range sources {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// busyAfter is how long a collection runs before its source sends a Busy batch
+const busyAfter = time.Second
+
+// poller is a Source that calls collect on its own goroutine every interval; most source
+// kinds are a poller around a function that reads once. Collections never overlap: one that
+// outlasts the interval delays the next. The context passed to collect is cancelled by Stop,
+// so a slow request or command is abandoned.
+type poller struct {
+	title    string
+	busy     string // what a long collection is doing, for Batch.Busy
+	interval time.Duration
+	collect  func(ctx context.Context) Batch
+	cancel   context.CancelFunc
+}
+
+// newPoller creates a source that calls collect every interval
+func newPoller(title string, interval time.Duration, collect func(ctx context.Context) Batch) *poller {
+	return &poller{title: title, busy: "collecting…", interval: interval, collect: collect}
+}
+
+func (p *poller) Title() string {
+	return p.title
+}
+
+// Start collects right away, then every interval until Stop
+func (p *poller) Start(out chan<- Batch) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			batch, ok := p.collectOnce(ctx, out)
+			if !ok {
+				return
+			}
+			batch.Source = p
+			select {
+			case out <- batch:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// collectOnce runs collect, sending a Busy batch first if it runs longer than busyAfter;
+// ok is false when the poller was stopped meanwhile
+func (p *poller) collectOnce(ctx context.Context, out chan<- Batch) (Batch, bool) {
+	start := time.Now()
+	result := make(chan Batch, 1)
+	go func() {
+		result <- p.collect(ctx)
+	}()
+	timer := time.NewTimer(busyAfter)
+	defer timer.Stop()
+	select {
+	case batch := <-result:
+		// a collection cut short by Stop is dropped rather than shown as an error
+		return batch, ctx.Err() == nil
+	case <-timer.C:
+	}
+	select {
+	case out <- Batch{Source: p, Time: start, Busy: p.busy}:
+	case <-ctx.Done():
+		return Batch{}, false
+	}
+	// collect returns promptly once ctx is cancelled
+	batch := <-result
+	return batch, ctx.Err() == nil
+}
+
+// Stop ends the polling goroutine, cancelling a collection in progress
+func (p *poller) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+}
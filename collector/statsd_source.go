@@ -0,0 +1,411 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterSource("statsd", newStatsdSource)
+}
+
+// statsdSource listens for StatsD metrics on a UDP port and sends what arrived, aggregated the
+// way the StatsD daemon does, once every interval (the flush interval):
+//
+//	jobs.done:1|c          counter: per-second rate over the interval (0 when nothing came)
+//	queue.depth:42|g       gauge: the latest value, kept until the next one (+N/-N adjust it)
+//	db.query:12.5|ms       timer (also |h and |d): name_count, _lower, _mean, _p90 and _upper
+//	users.seen:alice|s     set: distinct values in the interval
+//
+// Counters and timers may carry a sample rate (|@0.1) and any line DogStatsD tags
+// (|#env:prod,region), which become labels. Every series also gets a type label (counter, gauge,
+// timer or set), so a counter and a gauge sent under the same name stay apart. Names are made
+// Prometheus-safe (jobs.done => jobs_done) so --metric selectors and functions work on them. Unlike polling sources the
+// first batch comes one interval after Start.
+type statsdSource struct {
+	listener *statsdListener
+	title    string
+	interval time.Duration
+	reader   *scrapeReader // nil sends every series
+	cancel   context.CancelFunc
+
+	mu     sync.Mutex
+	agg    *statsdAggregator
+	last   time.Time // when the current interval started
+	bad    int       // malformed lines since the last flush
+	badErr error     // the first of them
+}
+
+// newStatsdSource listens on cfg.URL (":8125", "127.0.0.1:8125"); cfg.Exprs picks and computes
+// series like a scrape's --metric expressions. Sources on the same address share the port.
+func newStatsdSource(cfg SourceConfig) (Source, error) {
+	addr := cfg.URL
+	if addr == "" {
+		addr = ":8125"
+	}
+	s := &statsdSource{title: "StatsD " + addr, interval: cfg.Interval, agg: newStatsdAggregator(), last: time.Now()}
+	if len(cfg.Exprs) > 0 {
+		reader, err := newScrapeReader(cfg.Exprs)
+		if err != nil {
+			return nil, err
+		}
+		s.reader = reader
+	}
+	listener, err := joinStatsdListener(addr, s)
+	if err != nil {
+		return nil, err
+	}
+	s.listener = listener
+	return s, nil
+}
+
+func (s *statsdSource) Title() string {
+	return s.title
+}
+
+// Start flushes every interval on its own goroutine (the port is read from the start)
+func (s *statsdSource) Start(out chan<- Batch) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				batch := s.flush(now)
+				batch.Source = s
+				select {
+				case out <- batch:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// receive folds one packet's lines in
+func (s *statsdSource) receive(metrics []statsdMetric, bad int, badErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range metrics {
+		s.agg.add(m)
+	}
+	if bad > 0 && s.bad == 0 {
+		s.badErr = badErr
+	}
+	s.bad += bad
+}
+
+// flush aggregates what arrived since the last flush into a batch taken at now
+func (s *statsdSource) flush(now time.Time) Batch {
+	s.mu.Lock()
+	samples := s.agg.flush(now.Sub(s.last))
+	bad, badErr := s.bad, s.badErr
+	s.last, s.bad, s.badErr = now, 0, nil
+	s.mu.Unlock()
+
+	var err error
+	switch {
+	case bad == 1:
+		err = badErr
+	case bad > 1:
+		err = fmt.Errorf("%d bad lines, %w", bad, badErr)
+	}
+	if s.reader != nil {
+		return s.reader.batch(now, &Exposition{Samples: samples, Families: map[string]*MetricFamily{}}, err)
+	}
+	batch := Batch{Time: now, Readings: make([]Reading, len(samples)), Err: err}
+	for i, sample := range samples {
+		batch.Readings[i] = Reading{Key: sample.String(), Group: sample.Name, Sample: sample}
+	}
+	return batch
+}
+
+// Stop stops flushing and leaves the port (closed once no source listens on it)
+func (s *statsdSource) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	if s.listener != nil {
+		s.listener.leave(s)
+		s.listener = nil
+	}
+}
+
+// statsdListener reads one UDP port and hands every packet to the sources listening on it
+type statsdListener struct {
+	addr    string
+	conn    net.PacketConn
+	sources map[*statsdSource]bool // guarded by listenersMu
+}
+
+var (
+	listenersMu sync.Mutex
+	listeners   = map[string]*statsdListener{} // by address
+)
+
+// joinStatsdListener adds a source to the listener on addr, binding the port if nobody has yet
+func joinStatsdListener(addr string, s *statsdSource) (*statsdListener, error) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	l, ok := listeners[addr]
+	if !ok {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("statsd: %w", err)
+		}
+		l = &statsdListener{addr: addr, conn: conn, sources: map[*statsdSource]bool{}}
+		listeners[addr] = l
+		go l.read()
+	}
+	l.sources[s] = true
+	return l, nil
+}
+
+// leave removes a source, closing the port after the last one
+func (l *statsdListener) leave(s *statsdSource) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	delete(l.sources, s)
+	if len(l.sources) == 0 {
+		delete(listeners, l.addr)
+		l.conn.Close()
+	}
+}
+
+// read parses packets until the port is closed
+func (l *statsdListener) read() {
+	buf := make([]byte, 65535) // the largest UDP payload
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		var metrics []statsdMetric
+		var bad int
+		var badErr error
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			m, err := parseStatsdLine(line)
+			if err != nil {
+				if bad == 0 {
+					badErr = err
+				}
+				bad++
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+		listenersMu.Lock()
+		for s := range l.sources {
+			s.receive(metrics, bad, badErr)
+		}
+		listenersMu.Unlock()
+	}
+}
+
+// statsdMetric is one parsed StatsD line
+type statsdMetric struct {
+	name     string
+	labels   map[string]string
+	kind     string  // c, g, ms or s (h and d are read as ms)
+	value    float64 // unused for sets
+	member   string  // sets: the value as sent
+	relative bool    // gauges: +N or -N adjusts the current value
+	rate     float64 // sample rate in (0, 1]
+}
+
+// parseStatsdLine parses name:value|type[|@rate][|#tag:value,...]
+func parseStatsdLine(line string) (statsdMetric, error) {
+	m := statsdMetric{rate: 1}
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return m, fmt.Errorf("statsd line %q: expected name:value|type", line)
+	}
+	m.name = statsdName(name)
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return m, fmt.Errorf("statsd line %q: expected name:value|type", line)
+	}
+	value := parts[0]
+	switch m.kind = parts[1]; m.kind {
+	case "c", "g", "ms", "s":
+	case "h", "d":
+		m.kind = "ms"
+	default:
+		return m, fmt.Errorf("statsd line %q: unknown type %q", line, parts[1])
+	}
+	for _, field := range parts[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return m, fmt.Errorf("statsd line %q: invalid sample rate %q", line, field)
+			}
+			m.rate = rate
+		case strings.HasPrefix(field, "#"):
+			m.labels = map[string]string{}
+			for _, tag := range strings.Split(field[1:], ",") {
+				if tag == "" {
+					continue
+				}
+				k, v, _ := strings.Cut(tag, ":")
+				m.labels[statsdName(k)] = v
+			}
+		}
+	}
+	if m.kind == "s" {
+		m.member = value
+		return m, nil
+	}
+	if m.kind == "g" && (strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")) {
+		m.relative = true
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return m, fmt.Errorf("statsd line %q: invalid value %q", line, value)
+	}
+	m.value = v
+	return m, nil
+}
+
+// statsdName makes a StatsD name or tag key a valid Prometheus name: characters other than
+// letters, digits, _ and : become _ (and a leading digit gets one in front)
+func statsdName(s string) string {
+	var b strings.Builder
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+			b.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// statsdTypes name the StatsD types in the type label of their series (a tag named type is
+// overwritten)
+var statsdTypes = map[string]string{"c": "counter", "g": "gauge", "ms": "timer", "s": "set"}
+
+// statsdAggregator accumulates metrics between flushes
+type statsdAggregator struct {
+	series map[string]*statsdSeries // by series (its type label included)
+}
+
+// statsdSeries is one metric's state: a counter's total, a gauge's value, a timer's values or a
+// set's members since the last flush
+type statsdSeries struct {
+	name    string
+	labels  map[string]string
+	kind    string
+	value   float64
+	count   float64 // timers: values received, scaled by their sample rates
+	values  []float64
+	members map[string]bool
+}
+
+func newStatsdAggregator() *statsdAggregator {
+	return &statsdAggregator{series: map[string]*statsdSeries{}}
+}
+
+// add folds one metric in
+func (a *statsdAggregator) add(m statsdMetric) {
+	labels := make(map[string]string, len(m.labels)+1)
+	for k, v := range m.labels {
+		labels[k] = v
+	}
+	labels["type"] = statsdTypes[m.kind]
+	key := FormatSeries(m.name, labels)
+	s, ok := a.series[key]
+	if !ok {
+		s = &statsdSeries{name: m.name, labels: labels, kind: m.kind, members: map[string]bool{}}
+		a.series[key] = s
+	}
+	switch m.kind {
+	case "c":
+		s.value += m.value / m.rate
+	case "g":
+		if m.relative {
+			s.value += m.value
+		} else {
+			s.value = m.value
+		}
+	case "ms":
+		s.values = append(s.values, m.value)
+		s.count += 1 / m.rate
+	case "s":
+		s.members[m.member] = true
+	}
+}
+
+// flush turns what accumulated over elapsed into samples (sorted by series) and starts the next
+// interval. Counters and sets seen before report 0 when nothing came; gauges keep their value.
+func (a *statsdAggregator) flush(elapsed time.Duration) []Sample {
+	var samples []Sample
+	for _, s := range a.series {
+		switch s.kind {
+		case "c":
+			if seconds := elapsed.Seconds(); seconds > 0 {
+				samples = append(samples, Sample{Name: s.name, Labels: s.labels, Value: s.value / seconds})
+			}
+			s.value = 0
+		case "g":
+			samples = append(samples, Sample{Name: s.name, Labels: s.labels, Value: s.value})
+		case "ms":
+			if len(s.values) == 0 {
+				continue
+			}
+			sort.Float64s(s.values)
+			sum := 0.0
+			for _, v := range s.values {
+				sum += v
+			}
+			n := len(s.values)
+			stats := []struct {
+				suffix string
+				value  float64
+			}{
+				{"_count", s.count},
+				{"_lower", s.values[0]},
+				{"_mean", sum / float64(n)},
+				{"_p90", s.values[int(math.Ceil(0.9*float64(n)))-1]},
+				{"_upper", s.values[n-1]},
+			}
+			for _, st := range stats {
+				samples = append(samples, Sample{Name: s.name + st.suffix, Labels: s.labels, Value: st.value})
+			}
+			s.values, s.count = s.values[:0], 0
+		case "s":
+			samples = append(samples, Sample{Name: s.name, Labels: s.labels, Value: float64(len(s.members))})
+			s.members = map[string]bool{}
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].String() < samples[j].String()
+	})
+	return samples
+}
@@ -0,0 +1,215 @@
+package collector
+
+import (
+	"maps"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatsdLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want statsdMetric
+	}{
+		{line: "jobs.done:1|c", want: statsdMetric{name: "jobs_done", kind: "c", value: 1, rate: 1}},
+		{line: "jobs.done:2|c|@0.5", want: statsdMetric{name: "jobs_done", kind: "c", value: 2, rate: 0.5}},
+		{line: "queue-depth:42|g", want: statsdMetric{name: "queue_depth", kind: "g", value: 42, rate: 1}},
+		{line: "queue.depth:-3|g", want: statsdMetric{name: "queue_depth", kind: "g", value: -3, relative: true, rate: 1}},
+		{line: "db.query:12.5|ms", want: statsdMetric{name: "db_query", kind: "ms", value: 12.5, rate: 1}},
+		{line: "db.query:7|h", want: statsdMetric{name: "db_query", kind: "ms", value: 7, rate: 1}},
+		{line: "users.seen:alice|s", want: statsdMetric{name: "users_seen", kind: "s", member: "alice", rate: 1}},
+		{line: "2xx:1|c|#env:prod,region,,http.code:200", want: statsdMetric{name: "_2xx", kind: "c", value: 1, rate: 1,
+			labels: map[string]string{"env": "prod", "region": "", "http_code": "200"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := parseStatsdLine(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.name != tt.want.name || got.kind != tt.want.kind || got.value != tt.want.value || got.member != tt.want.member ||
+				got.relative != tt.want.relative || got.rate != tt.want.rate || !maps.Equal(got.labels, tt.want.labels) {
+				t.Errorf("parseStatsdLine = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStatsdLineErrors(t *testing.T) {
+	for _, line := range []string{
+		"jobs.done",         // no value
+		":1|c",              // no name
+		"jobs.done:1",       // no type
+		"jobs.done:1|x",     // unknown type
+		"jobs.done:one|c",   // not a number
+		"jobs.done:NaN|g",   // not a usable number
+		"jobs.done:1|c|@0",  // sample rate out of range
+		"jobs.done:1|c|@2",  // sample rate out of range
+		"jobs.done:1|c|@x",  // sample rate not a number
+		"jobs.done:+Inf|ms", // not a usable number
+	} {
+		if _, err := parseStatsdLine(line); err == nil {
+			t.Errorf("parseStatsdLine(%q) = nil error", line)
+		}
+	}
+}
+
+func TestStatsdAggregator(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		elapsed time.Duration
+		want    map[string]float64 // series => value
+		next    map[string]float64 // an empty interval after that
+	}{
+		{
+			name:    "counter",
+			lines:   []string{"jobs:1|c", "jobs:3|c", "jobs:1|c|@0.1"},
+			elapsed: 2 * time.Second,
+			want:    map[string]float64{`jobs{type="counter"}`: 7},
+			next:    map[string]float64{`jobs{type="counter"}`: 0},
+		},
+		{
+			name:    "gauge",
+			lines:   []string{"depth:10|g", "depth:+5|g", "depth:-2|g"},
+			elapsed: time.Second,
+			want:    map[string]float64{`depth{type="gauge"}`: 13},
+			next:    map[string]float64{`depth{type="gauge"}`: 13},
+		},
+		{
+			name:    "timer",
+			lines:   []string{"q:30|ms", "q:10|ms", "q:20|ms|@0.5"},
+			elapsed: time.Second,
+			want: map[string]float64{`q_count{type="timer"}`: 4, `q_lower{type="timer"}`: 10, `q_mean{type="timer"}`: 20,
+				`q_p90{type="timer"}`: 30, `q_upper{type="timer"}`: 30},
+			next: map[string]float64{},
+		},
+		{
+			name:    "set",
+			lines:   []string{"users:alice|s", "users:bob|s", "users:alice|s"},
+			elapsed: time.Second,
+			want:    map[string]float64{`users{type="set"}`: 2},
+			next:    map[string]float64{`users{type="set"}`: 0},
+		},
+		{
+			name:    "same name, other types",
+			lines:   []string{"x:4|c", "x:9|g", "x:1|s"},
+			elapsed: 2 * time.Second,
+			want:    map[string]float64{`x{type="counter"}`: 2, `x{type="gauge"}`: 9, `x{type="set"}`: 1},
+			next:    map[string]float64{`x{type="counter"}`: 0, `x{type="gauge"}`: 9, `x{type="set"}`: 0},
+		},
+		{
+			name:    "tags",
+			lines:   []string{"req:1|c|#env:prod", "req:1|c|#env:dev", "req:1|c|#env:prod,type:web"},
+			elapsed: time.Second,
+			// a type tag is overwritten by the StatsD type
+			want: map[string]float64{`req{env="dev",type="counter"}`: 1, `req{env="prod",type="counter"}`: 2},
+			next: map[string]float64{`req{env="dev",type="counter"}`: 0, `req{env="prod",type="counter"}`: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg := newStatsdAggregator()
+			for _, line := range tt.lines {
+				m, err := parseStatsdLine(line)
+				if err != nil {
+					t.Fatal(err)
+				}
+				agg.add(m)
+			}
+			checkSamples(t, "flush", agg.flush(tt.elapsed), tt.want)
+			checkSamples(t, "next flush", agg.flush(tt.elapsed), tt.next)
+		})
+	}
+}
+
+func TestStatsdSource(t *testing.T) {
+	cfg := SourceConfig{URL: "127.0.0.1:0", Interval: 50 * time.Millisecond}
+	src, err := NewSource("statsd", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Stop()
+	// a second source on the address shares the port, and picks its series
+	cfg.Exprs = []string{`jobs{type="counter"}`}
+	picked, err := NewSource("statsd", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer picked.Stop()
+	addr := src.(*statsdSource).listener.conn.LocalAddr().String()
+	if picked.(*statsdSource).listener != src.(*statsdSource).listener {
+		t.Fatal("sources on one address didn't share the listener")
+	}
+
+	client, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		name    string
+		source  Source
+		want    []string // series in the first batch with readings
+		wantErr string
+	}{
+		{name: "every series", source: src, want: []string{`jobs{type="counter"}`, `jobs{type="gauge"}`}, wantErr: "2 bad lines"},
+		{name: "picked", source: picked, want: []string{`jobs{type="counter"}`}, wantErr: "2 bad lines"},
+	}
+	batches := make(chan Batch)
+	for _, tt := range tests {
+		tt.source.Start(batches)
+	}
+	// one packet, several lines, two of them bad
+	if _, err := client.Write([]byte("jobs:1|c\njobs:5|g\nnonsense\njobs:1|x\n")); err != nil {
+		t.Fatal(err)
+	}
+	got := map[Source]Batch{}
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(tests) {
+		select {
+		case batch := <-batches:
+			if len(batch.Readings) > 0 {
+				got[batch.Source] = batch
+			}
+		case <-timeout:
+			t.Fatalf("only %d of %d sources sent what was received", len(got), len(tests))
+		}
+	}
+	for _, tt := range tests {
+		batch := got[tt.source]
+		var series []string
+		for _, r := range batch.Readings {
+			series = append(series, r.Sample.String())
+		}
+		if strings.Join(series, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: series = %v, want %v", tt.name, series, tt.want)
+		}
+		if batch.Err == nil || !strings.Contains(batch.Err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, batch.Err, tt.wantErr)
+		}
+	}
+
+	// the port stays open while a source listens, and closes after the last one leaves
+	conn := src.(*statsdSource).listener.conn
+	src.Stop()
+	picked.Stop()
+	if _, _, err := conn.ReadFrom(make([]byte, 1)); err == nil {
+		t.Error("the port is still open after every source stopped")
+	}
+}
+
+// checkSamples compares samples to want (series => value)
+func checkSamples(t *testing.T, what string, samples []Sample, want map[string]float64) {
+	t.Helper()
+	got := map[string]float64{}
+	for _, s := range samples {
+		got[s.String()] = s.Value
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+	}
+}
@@ -0,0 +1,245 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterSource("system", newSystemSource)
+}
+
+// SystemViews are the views a system source can show (cfg.Exprs), in the order --system lays
+// them out
+var SystemViews = []string{"cpu", "cpufreq", "memory", "network", "disk"}
+
+// systemViewTitles describe each view (the widget title)
+var systemViewTitles = map[string]string{
+	"cpu":     "CPU usage %",
+	"cpufreq": "CPU frequency MHz",
+	"memory":  "Memory used %",
+	"network": "Network bytes/s",
+	"disk":    "Disk IO bytes/s",
+}
+
+// systemView reads one view's values at now
+type systemView func(now time.Time) ([]Reading, error)
+
+// newSystemSource reads this machine's /proc and /sys (or those under cfg.Root) every interval;
+// cfg.Exprs names the views to show (see SystemViews). Usage and IO rates are per interval; the
+// first reading is the average since boot.
+func newSystemSource(cfg SourceConfig) (Source, error) {
+	if len(cfg.Exprs) == 0 {
+		return nil, fmt.Errorf("system source: no view (one of %s)", strings.Join(SystemViews, ", "))
+	}
+	views := make([]systemView, len(cfg.Exprs))
+	for i, name := range cfg.Exprs {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "cpu":
+			views[i] = cpuUsageView(cfg.Root)
+		case "cpufreq":
+			views[i] = cpuFreqView(cfg.Root)
+		case "memory":
+			views[i] = memoryView(cfg.Root)
+		case "network":
+			views[i] = networkView(cfg.Root)
+		case "disk":
+			views[i] = diskView(cfg.Root)
+		default:
+			return nil, fmt.Errorf("system source: unknown view %q (available: %s)", name, strings.Join(SystemViews, ", "))
+		}
+	}
+	title := "System"
+	if len(cfg.Exprs) == 1 {
+		title = systemViewTitles[strings.ToLower(strings.TrimSpace(cfg.Exprs[0]))]
+	}
+	return newPoller(title, cfg.Interval, func(ctx context.Context) Batch {
+		batch := Batch{Time: time.Now()}
+		for _, view := range views {
+			readings, err := view(batch.Time)
+			if err != nil {
+				return Batch{Time: batch.Time, Err: err}
+			}
+			batch.Readings = append(batch.Readings, readings...)
+		}
+		return batch
+	}), nil
+}
+
+// cpuUsageView is the busy percentage of each CPU over the last interval, from /proc/stat
+func cpuUsageView(root string) systemView {
+	prev := map[string]CPUTimes{} // empty on the first read: usage since boot
+	return func(time.Time) ([]Reading, error) {
+		cpus, err := ReadCPUStat(root)
+		if err != nil {
+			return nil, err
+		}
+		var readings []Reading
+		next := make(map[string]CPUTimes, len(cpus))
+		for _, c := range cpus {
+			next[c.CPU] = c
+			p := prev[c.CPU]
+			total := c.Total() - p.Total()
+			if total <= 0 {
+				continue // no ticks since the last read (or the counters went back)
+			}
+			usage := 100 * (1 - (c.IdleAll()-p.IdleAll())/total)
+			sample := Sample{Name: "cpu_usage_percent", Labels: map[string]string{"cpu": c.CPU}, Value: math.Max(0, math.Min(100, usage))}
+			readings = append(readings, Reading{Key: "cpu" + c.CPU, Group: systemViewTitles["cpu"], Sample: sample})
+		}
+		prev = next
+		return readings, nil
+	}
+}
+
+// cpuFreqView is each CPU's current frequency, from /sys/devices/system/cpu/cpuN/cpufreq
+func cpuFreqView(root string) systemView {
+	return func(time.Time) ([]Reading, error) {
+		freqs, err := ReadCPUFreq(root)
+		if err != nil {
+			return nil, err
+		}
+		if len(freqs) == 0 {
+			return nil, fmt.Errorf("no cpufreq in %s (not exposed on this machine)", procPath(root, "sys", "devices", "system", "cpu"))
+		}
+		readings := make([]Reading, len(freqs))
+		for i, f := range freqs {
+			sample := Sample{Name: "cpu_frequency_mhz", Labels: map[string]string{"cpu": f.CPU}, Value: f.MHz}
+			readings[i] = Reading{Key: "cpu" + f.CPU, Group: systemViewTitles["cpufreq"], Sample: sample}
+		}
+		return readings, nil
+	}
+}
+
+// memoryView is the share of memory (and swap, when there is any) in use, from /proc/meminfo
+func memoryView(root string) systemView {
+	return func(time.Time) ([]Reading, error) {
+		info, err := ReadMemInfo(root)
+		if err != nil {
+			return nil, err
+		}
+		available, ok := info["MemAvailable"]
+		if !ok {
+			// kernels before 3.14 don't estimate it
+			available = info["MemFree"] + info["Buffers"] + info["Cached"]
+		}
+		group := systemViewTitles["memory"]
+		readings := []Reading{{Key: "memory", Group: group, Sample: Sample{Name: "memory", Value: 100 * (1 - available/info["MemTotal"])}}}
+		if swap := info["SwapTotal"]; swap > 0 {
+			readings = append(readings, Reading{Key: "swap", Group: group, Sample: Sample{Name: "swap", Value: 100 * (1 - info["SwapFree"]/swap)}})
+		}
+		return readings, nil
+	}
+}
+
+// networkView is each interface's receive and transmit rate, from /proc/net/dev (loopback and
+// interfaces that never saw traffic are left out)
+func networkView(root string) systemView {
+	r := &counterRates{root: root}
+	return func(now time.Time) ([]Reading, error) {
+		devs, err := ReadNetDev(root)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.begin(now); err != nil {
+			return nil, err
+		}
+		defer r.end(now)
+		var readings []Reading
+		for _, d := range devs {
+			if d.Interface == "lo" || d.RxBytes+d.TxBytes == 0 {
+				continue
+			}
+			readings = r.appendRate(readings, "rx", d.Interface, d.RxBytes, "network")
+			readings = r.appendRate(readings, "tx", d.Interface, d.TxBytes, "network")
+		}
+		return readings, nil
+	}
+}
+
+// diskView is each disk's read and write rate, from /proc/diskstats; partitions, loop and ram
+// devices and disks that were never used are left out
+func diskView(root string) systemView {
+	r := &counterRates{root: root}
+	return func(now time.Time) ([]Reading, error) {
+		stats, err := ReadDiskStats(root)
+		if err != nil {
+			return nil, err
+		}
+		var disks map[string]bool // nil when /sys/block can't tell disks from partitions
+		if devices := BlockDevices(root); devices != nil {
+			disks = map[string]bool{}
+			for _, d := range devices {
+				disks[d] = true
+			}
+		}
+		if err := r.begin(now); err != nil {
+			return nil, err
+		}
+		defer r.end(now)
+		var readings []Reading
+		for _, d := range stats {
+			if (disks != nil && !disks[d.Device]) || strings.HasPrefix(d.Device, "loop") || strings.HasPrefix(d.Device, "ram") {
+				continue
+			}
+			if d.ReadsCompleted+d.WritesCompleted == 0 {
+				continue
+			}
+			readings = r.appendRate(readings, "read", d.Device, d.ReadBytes(), "disk")
+			readings = r.appendRate(readings, "write", d.Device, d.WrittenBytes(), "disk")
+		}
+		return readings, nil
+	}
+}
+
+// counterRates turns counters into per-second rates between reads. The first read has nothing to
+// compare with, so it is the average since boot (counters start at 0 then).
+type counterRates struct {
+	root       string
+	last       time.Time
+	elapsed    float64            // seconds covered by this read
+	prev, next map[string]float64 // counter values by key at the last and this read
+}
+
+// begin starts a read at now
+func (r *counterRates) begin(now time.Time) error {
+	r.next = map[string]float64{}
+	if r.last.IsZero() {
+		uptime, err := ReadUptime(r.root)
+		if err != nil {
+			return err
+		}
+		r.elapsed = uptime
+		return nil
+	}
+	r.elapsed = now.Sub(r.last).Seconds()
+	return nil
+}
+
+// appendRate adds the rate of one counter (name, e.g. "rx", for device) to readings; a device that
+// appeared since the last read has no rate yet
+func (r *counterRates) appendRate(readings []Reading, name, device string, value float64, view string) []Reading {
+	key := name + " " + device
+	r.next[key] = value
+	prev, ok := r.prev[key]
+	if !ok && !r.last.IsZero() {
+		return readings
+	}
+	if value < prev {
+		prev = 0 // counter reset (e.g. the interface was re-created)
+	}
+	if r.elapsed <= 0 {
+		return readings
+	}
+	sample := Sample{Name: name, Labels: map[string]string{"device": device}, Value: (value - prev) / r.elapsed}
+	return append(readings, Reading{Key: key, Group: systemViewTitles[view], Sample: sample})
+}
+
+// end finishes the read started at now
+func (r *counterRates) end(now time.Time) {
+	r.prev, r.last = r.next, now
+}
@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSystemViews(t *testing.T) {
+	const uptime = 1000.5
+	tests := []struct {
+		name   string
+		view   func(root string) systemView
+		first  map[string]float64 // series => value on the first read (since boot)
+		update map[string]string  // files under the root rewritten before the second read
+		second map[string]float64 // series => value 10s later
+	}{
+		{
+			name: "cpu",
+			view: cpuUsageView,
+			first: map[string]float64{
+				`cpu_usage_percent{cpu="0"}`: 100 * (1 - 1848050.0/1850129),
+				`cpu_usage_percent{cpu="1"}`: 100 * (1 - 1874186.0/1878029),
+			},
+			update: map[string]string{
+				// cpu0 spent half of 100 ticks busy; cpu1 didn't tick, so it has no usage
+				"proc/stat": "cpu0 1443 280 283 1836950 11150 0 123 0 0 0\ncpu1 3312 76 301 1862276 11910 0 154 0 0 0\n",
+			},
+			second: map[string]float64{`cpu_usage_percent{cpu="0"}`: 50},
+		},
+		{
+			name: "cpufreq",
+			view: cpuFreqView,
+			first: map[string]float64{
+				`cpu_frequency_mhz{cpu="0"}`:  2400,
+				`cpu_frequency_mhz{cpu="1"}`:  1800,
+				`cpu_frequency_mhz{cpu="10"}`: 3000,
+			},
+			update: map[string]string{"sys/devices/system/cpu/cpu0/cpufreq/scaling_cur_freq": "800000\n"},
+			second: map[string]float64{
+				`cpu_frequency_mhz{cpu="0"}`:  800,
+				`cpu_frequency_mhz{cpu="1"}`:  1800,
+				`cpu_frequency_mhz{cpu="10"}`: 3000,
+			},
+		},
+		{
+			name:   "memory",
+			view:   memoryView,
+			first:  map[string]float64{"memory": 75, "swap": 25},
+			update: map[string]string{"proc/meminfo": "MemTotal: 1000 kB\nMemFree: 100 kB\nBuffers: 100 kB\nCached: 200 kB\nSwapTotal: 0 kB\n"},
+			// no MemAvailable (kernels before 3.14) and no swap
+			second: map[string]float64{"memory": 60},
+		},
+		{
+			name: "network",
+			view: networkView,
+			// lo and the idle wlan0 are left out
+			first: map[string]float64{`rx{device="eth0"}`: 2000000 / uptime, `tx{device="eth0"}`: 500000 / uptime},
+			update: map[string]string{"proc/net/dev": "Inter-| Receive | Transmit\n face |bytes packets|bytes packets\n" +
+				"    lo: 2000000 6000 0 0 0 0 0 0 2000000 6000 0 0 0 0 0 0\n" +
+				"  eth0: 2004000 1504 1 2 0 0 0 0 500000 1200 0 3 0 0 0 0\n" +
+				"  eth1: 9000 10 0 0 0 0 0 0 9000 10 0 0 0 0 0 0\n"}, // eth1 is new: no rate yet
+			second: map[string]float64{`rx{device="eth0"}`: 400, `tx{device="eth0"}`: 0},
+		},
+		{
+			name: "disk",
+			view: diskView,
+			// sda1 is a partition, nvme0n1 was never used and loop0 is a loop device
+			first:  map[string]float64{`read{device="sda"}`: 20000 * 512 / uptime, `write{device="sda"}`: 8000 * 512 / uptime},
+			update: map[string]string{"proc/diskstats": "   8 0 sda 1010 10 20200 300 500 20 6000 400 0 700 700\n"},
+			// the written sectors went back: a counter reset counts from 0
+			second: map[string]float64{`read{device="sda"}`: 200 * 512 / 10, `write{device="sda"}`: 6000 * 512 / 10},
+		},
+	}
+	t0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.CopyFS(root, os.DirFS(sysroot)); err != nil {
+				t.Fatal(err)
+			}
+			view := tt.view(root)
+			checkReadings(t, "first read", view, t0, tt.first)
+			for file, data := range tt.update {
+				if err := os.WriteFile(filepath.Join(root, file), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkReadings(t, "second read", view, t0.Add(10*time.Second), tt.second)
+		})
+	}
+}
+
+func TestSystemViewErrors(t *testing.T) {
+	root := t.TempDir() // nothing to read
+	for _, view := range SystemViews {
+		src, err := NewSource("system", SourceConfig{Exprs: []string{view}, Root: root, Interval: time.Second})
+		if err != nil {
+			t.Fatalf("%s: %v", view, err)
+		}
+		if src.Title() != systemViewTitles[view] {
+			t.Errorf("%s: title = %q", view, src.Title())
+		}
+	}
+	for _, view := range []systemView{cpuUsageView(root), cpuFreqView(root), memoryView(root), networkView(root), diskView(root)} {
+		if _, err := view(time.Now()); err == nil {
+			t.Error("a view read a missing root without an error")
+		}
+	}
+	if _, err := NewSource("system", SourceConfig{Exprs: []string{"cpu", "gpu"}, Interval: time.Second}); err == nil || !strings.Contains(err.Error(), `unknown view "gpu"`) {
+		t.Errorf("err = %v, want an unknown view", err)
+	}
+	if _, err := NewSource("system", SourceConfig{Interval: time.Second}); err == nil {
+		t.Error("a system source without views was accepted")
+	}
+}
+
+// checkReadings reads view at now and compares its readings to want (series => value)
+func checkReadings(t *testing.T, what string, view systemView, now time.Time, want map[string]float64) {
+	t.Helper()
+	readings, err := view(now)
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	got := map[string]float64{}
+	for _, r := range readings {
+		got[r.Sample.String()] = r.Value
+	}
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+		return
+	}
+	for series, v := range want {
+		if g, ok := got[series]; !ok || math.Abs(g-v) > 1e-9*math.Max(1, math.Abs(v)) {
+			t.Errorf("%s: %s = %v, want %v", what, series, g, v)
+		}
+	}
+}
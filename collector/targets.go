@@ -0,0 +1,177 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TargetURL turns a scrape target into a metrics URL: a bare host:port gets http:// and, like
+// Prometheus, the /metrics path (http://host:9100 => http://host:9100/metrics)
+func TargetURL(target string) string {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return ""
+	}
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return target // the scrape reports it
+	}
+	if u.Path == "" {
+		u.Path = "/metrics"
+	}
+	return u.String()
+}
+
+// NormalizeTargets makes every target a metrics URL (see TargetURL), dropping blanks and duplicates
+func NormalizeTargets(targets []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range targets {
+		u := TargetURL(t)
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		out = append(out, u)
+	}
+	return out
+}
+
+// Instance names a target the way Prometheus' instance label does: its host:port
+func Instance(metricsURL string) string {
+	if u, err := url.Parse(metricsURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return metricsURL
+}
+
+// LoadTargets reads a target file: one target per line (host:port or a URL; # starts a comment),
+// or a Prometheus file_sd JSON list ([{"targets": ["host:9100", ...]}, ...]). It returns the
+// targets as metrics URLs.
+func LoadTargets(path string) ([]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	if text := strings.TrimSpace(string(raw)); strings.HasPrefix(text, "[") {
+		var groups []struct {
+			Targets []string `json:"targets"`
+		}
+		if err := json.Unmarshal(raw, &groups); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, g := range groups {
+			targets = append(targets, g.Targets...)
+		}
+	} else {
+		for _, line := range strings.Split(text, "\n") {
+			line, _, _ = strings.Cut(line, "#")
+			targets = append(targets, strings.FieldsFunc(line, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t' || r == '\r'
+			})...)
+		}
+	}
+	targets = NormalizeTargets(targets)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets", path)
+	}
+	return targets, nil
+}
+
+// ScrapeTargets scrapes every target at once and merges the pages into one exposition, each
+// sample tagged with an instance label naming its target (an instance label the page already
+// had is kept as exported_instance, as Prometheus does). Targets that fail are summed up in the
+// error; the exposition holds the others and is nil only when every target failed.
+func (s *Scraper) ScrapeTargets(ctx context.Context, targets []string) (*Exposition, error) {
+	return parseTargets(s.fetchTargets(ctx, targets), false)
+}
+
+// page is one target's fetched metrics page, or why it couldn't be fetched
+type page struct {
+	target      string
+	body        []byte
+	contentType string // "" when unknown (the Prometheus text format)
+	err         error
+}
+
+// fetchTargets fetches every target at once and waits for all of them
+func (s *Scraper) fetchTargets(ctx context.Context, targets []string) []page {
+	pages := make([]page, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		pages[i].target = target
+		wg.Go(func() {
+			pages[i].body, pages[i].contentType, pages[i].err = s.Fetch(ctx, target)
+		})
+	}
+	wg.Wait()
+	return pages
+}
+
+// parseTargets parses fetched pages; a single page is returned as is, several are merged with
+// an instance label on every sample (see ScrapeTargets). labeled labels a single page too, for
+// callers whose pages may come from several targets at other times (replays of split widgets).
+func parseTargets(pages []page, labeled bool) (*Exposition, error) {
+	if len(pages) == 1 && !labeled {
+		if pages[0].err != nil {
+			return nil, pages[0].err
+		}
+		return parsePage(pages[0].body, pages[0].contentType)
+	}
+
+	merged := &Exposition{Families: map[string]*MetricFamily{}}
+	var failed []string
+	var firstErr error
+	for _, p := range pages {
+		instance := Instance(p.target)
+		var parsed *Exposition
+		err := p.err
+		if err == nil {
+			parsed, err = parsePage(p.body, p.contentType)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", instance, err)
+			}
+			failed = append(failed, instance)
+			continue
+		}
+		for _, sample := range parsed.Samples {
+			labels := make(map[string]string, len(sample.Labels)+1)
+			for k, v := range sample.Labels {
+				labels[k] = v
+			}
+			if v, ok := labels["instance"]; ok {
+				labels["exported_instance"] = v
+			}
+			labels["instance"] = instance
+			sample.Labels = labels
+			merged.Samples = append(merged.Samples, sample)
+		}
+		for name, family := range parsed.Families {
+			if _, ok := merged.Families[name]; !ok {
+				merged.Families[name] = family
+			}
+		}
+	}
+	switch {
+	case len(failed) == len(pages) && len(pages) == 1:
+		return nil, firstErr
+	case len(failed) == len(pages):
+		return nil, fmt.Errorf("all %d targets failed, %w", len(pages), firstErr)
+	case len(failed) == 1:
+		return merged, firstErr
+	case len(failed) > 1:
+		return merged, fmt.Errorf("%d/%d targets failed, %w", len(failed), len(pages), firstErr)
+	}
+	return merged, nil
+}
@@ -1,12 +1,11 @@
 // Package collector fetches and parses metrics from exporters (e.g. Windows Exporter).
+// Live inputs are Sources (see source.go): each kind registers a factory with RegisterSource
+// and sends timestamped batches of samples that any widget can consume.
 package collector
 
 import (
-	"fmt"
-	"io"
-	"net/http"
+	"context"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -26,160 +25,117 @@ type CPUFrequencySnapshot struct {
 	Cores []CoreFrequency
 }
 
-// FetchCPUFrequency fetches metrics from the given URL, parses Prometheus text format,
-// and returns the current windows_cpu_core_frequency_mhz values. Call this every 60s from main's ticker.
+// FetchCPUFrequency fetches metrics from the given URL, parses the Prometheus text format,
+// and returns the current windows_cpu_core_frequency_mhz values. Live widgets don't call it: their
+// Source scrapes on its own goroutine.
 func FetchCPUFrequency(metricsURL string) (*CPUFrequencySnapshot, error) {
+	return DefaultScraper.FetchCPUFrequency(context.Background(), metricsURL)
+}
+
+// FetchCPUFrequency is FetchCPUFrequency using this scraper's timeout, auth and TLS settings
+func (s *Scraper) FetchCPUFrequency(ctx context.Context, metricsURL string) (*CPUFrequencySnapshot, error) {
 	// record when we fetched so x-axis (time) always increases
 	now := time.Now()
-	// HTTP GET the metrics endpoint (e.g. http://localhost:9182/metrics)
-	resp, err := http.Get(metricsURL)
-	if err != nil {
-		return nil, fmt.Errorf("fetch metrics: %w", err)
-	}
-	// ensure we close the body when we're done so we don't leak connections
-	defer resp.Body.Close()
-	// only accept 200 OK; otherwise body might be an error page
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("fetch metrics: status %s", resp.Status)
-	}
-	// read the whole body so we can split by lines (Prometheus format is text)
-	body, err := io.ReadAll(resp.Body)
+	exp, err := s.Scrape(ctx, metricsURL)
 	if err != nil {
-		return nil, fmt.Errorf("read metrics body: %w", err)
+		return nil, err
 	}
-	text := string(body)
-	// parse the text and extract only windows_cpu_core_frequency_mhz samples
-	cores, err := parseCPUFrequencyMetric(text)
-	if err != nil {
-		return nil, fmt.Errorf("parse metrics: %w", err)
-	}
-	// return one snapshot (time + values) for this 60s interval
-	return &CPUFrequencySnapshot{Time: now, Cores: cores}, nil
+	// return one snapshot (time + values) for this interval
+	return &CPUFrequencySnapshot{Time: now, Cores: cpuFrequencies(exp)}, nil
 }
 
 // coresToTrack lists which cores we include; each will be a separate line on the graph later.
 // For now only core "0,0"; add e.g. "0,1", "0,2" to get more lines on the same graph.
 var coresToTrack = []string{"0,0", "0,1", "0,2"}
 
-// parseCPUFrequencyMetric finds lines like: windows_cpu_core_frequency_mhz{core="0,0"} 1506
-// and returns a slice of CoreFrequency. Skips # comments and non-matching metrics.
-// Only includes cores in coresToTrack so we track one line first, then add more as needed.
-func parseCPUFrequencyMetric(text string) ([]CoreFrequency, error) {
-	// we'll append each parsed core here (only if it's in coresToTrack)
+// cpuFrequencies picks the windows_cpu_core_frequency_mhz samples (one per core, in page order),
+// keeping only cores in coresToTrack so the graph stays readable
+func cpuFrequencies(exp *Exposition) []CoreFrequency {
 	var out []CoreFrequency
-	// Prometheus format is one metric per line; split so we can iterate
-	lines := strings.Split(text, "\n")
-	for _, line := range lines {
-		// skip empty lines and comment lines (# HELP, # TYPE, or #)
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		// we only care about this metric name
-		if !strings.HasPrefix(line, "windows_cpu_core_frequency_mhz") {
+	for _, sample := range exp.Samples {
+		if sample.Name != "windows_cpu_core_frequency_mhz" {
 			continue
 		}
-		// line shape: windows_cpu_core_frequency_mhz{core="0,0"} 1506
-		// find the value: last field after whitespace
-		idx := strings.LastIndex(line, " ")
-		if idx == -1 {
-			continue
-		}
-		valueStr := strings.TrimSpace(line[idx:])
-		value, err := strconv.ParseFloat(valueStr, 64)
-		if err != nil {
-			continue
-		}
-		// extract label core="x,y" from the { ... } part
-		start := strings.Index(line, "{")
-		end := strings.Index(line, "}")
-		core := ""
-		if start != -1 && end != -1 && end > start {
-			labels := line[start+1 : end]
-			// simple parse: look for core="..."
-			if strings.HasPrefix(labels, "core=\"") {
-				closeQuote := strings.Index(labels[6:], "\"")
-				if closeQuote != -1 {
-					core = labels[6 : 6+closeQuote]
-				}
-			}
-		}
-		// include only cores we want to track (e.g. "0,0" for now; add more later for separate lines)
-		keep := false
+		core := sample.Labels["core"]
 		for _, c := range coresToTrack {
 			if core == c {
-				keep = true
+				out = append(out, CoreFrequency{Core: core, Mhz: sample.Value})
 				break
 			}
 		}
-		if !keep {
-			continue
-		}
-		// append this core's data for this snapshot
-		out = append(out, CoreFrequency{Core: core, Mhz: value})
 	}
-	return out, nil
+	return out
 }
 
-// GenericSnapshot holds one value per metric selector for a single scrape (for user-specified metrics).
+// GenericSnapshot holds what each metric selector matched in a single scrape (for user-specified metrics).
 type GenericSnapshot struct {
 	Time   time.Time
-	Values []float64 // len(Values) == len(selectors); Values[i] = value for selectors[i], or 0 if no match
+	Values []float64      // len(Values) == len(selectors); Values[i] = first series matched by selectors[i], or 0 if no match
+	Series []SeriesSample // every matched series, selector by selector (a selector can match several)
 }
 
-// FetchGenericMetrics fetches metrics from the URL and returns one value per selector.
-// Each selector is a Prometheus metric selector, e.g. go_gc_duration_seconds{quantile="0"}.
+// SeriesSample is one series matched by a selector
+type SeriesSample struct {
+	Selector int // index of the selector that matched
+	Sample
+}
+
+// Key identifies the series across scrapes (the same series matched by two selectors gets two keys)
+func (s SeriesSample) Key() string {
+	return strconv.Itoa(s.Selector) + " " + s.Sample.String()
+}
+
+// FetchGenericMetrics fetches metrics from the URL and returns what each selector matched.
+// Each selector is a PromQL-style series selector, e.g. go_gc_duration_seconds{quantile="0"} or
+// windows_cpu_time_total{mode=~"user|system"}; a selector can match several series.
 // Multiple selectors => multiple series on the same graph.
+// A selector may be wrapped in a function (e.g. rate(http_requests_total[1m]) or
+// histogram_quantile(0.99, http_duration_seconds_bucket)); the snapshot then holds the raw series
+// and an Evaluator turns consecutive snapshots into the function's result.
 func FetchGenericMetrics(metricsURL string, selectors []string) (*GenericSnapshot, error) {
+	return DefaultScraper.FetchGenericMetrics(context.Background(), metricsURL, selectors)
+}
+
+// FetchGenericMetrics is FetchGenericMetrics using this scraper's timeout, auth and TLS settings
+func (s *Scraper) FetchGenericMetrics(ctx context.Context, metricsURL string, selectors []string) (*GenericSnapshot, error) {
 	if len(selectors) == 0 {
 		return &GenericSnapshot{Time: time.Now(), Values: nil}, nil
 	}
-	now := time.Now()
-	resp, err := http.Get(metricsURL)
+	parsed, err := parseSelectors(selectors)
 	if err != nil {
-		return nil, fmt.Errorf("fetch metrics: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("fetch metrics: status %s", resp.Status)
-	}
-	body, err := io.ReadAll(resp.Body)
+	now := time.Now()
+	exp, err := s.Scrape(ctx, metricsURL)
 	if err != nil {
-		return nil, fmt.Errorf("read metrics body: %w", err)
+		return nil, err
 	}
-	text := string(body)
-	values := parseGenericMetrics(text, selectors)
-	return &GenericSnapshot{Time: now, Values: values}, nil
+	return selectSeries(now, exp, parsed), nil
 }
 
-// parseGenericMetrics matches each line against selectors; returns one value per selector (0 if no match).
-// Selector must match exactly as on the page (e.g. windows_memory_physical_total_bytes or name{label="val"}).
-func parseGenericMetrics(text string, selectors []string) []float64 {
-	values := make([]float64, len(selectors))
-	matched := make([]bool, len(selectors))
-	lines := strings.Split(text, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		idx := strings.LastIndex(line, " ")
-		if idx == -1 {
-			continue
-		}
-		valueStr := strings.TrimSpace(line[idx:])
-		value, err := strconv.ParseFloat(valueStr, 64)
+// parseSelectors parses each expression and returns the series selector inside it
+func parseSelectors(selectors []string) ([]*Selector, error) {
+	parsed := make([]*Selector, len(selectors))
+	for i, sel := range selectors {
+		expr, err := ParseExpr(sel)
 		if err != nil {
-			continue
+			return nil, err
 		}
-		metricPart := strings.TrimSpace(line[:idx])
-		for i, sel := range selectors {
-			if !matched[i] && metricPart == sel {
-				values[i] = value
-				matched[i] = true
-				break
+		parsed[i] = expr.Selector
+	}
+	return parsed, nil
+}
+
+// selectSeries builds the snapshot of what each selector matched in a scraped page
+func selectSeries(now time.Time, exp *Exposition, selectors []*Selector) *GenericSnapshot {
+	snapshot := &GenericSnapshot{Time: now, Values: make([]float64, len(selectors))}
+	for i, sel := range selectors {
+		for j, sample := range sel.Select(exp) {
+			if j == 0 {
+				snapshot.Values[i] = sample.Value
 			}
+			snapshot.Series = append(snapshot.Series, SeriesSample{Selector: i, Sample: sample})
 		}
 	}
-	return values
+	return snapshot
 }
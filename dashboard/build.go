@@ -0,0 +1,104 @@
+package dashboard
+
+import (
+	"console-viz/draw"
+	"console-viz/styling"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WidgetFactory creates the widget for one leaf of the layout
+type WidgetFactory func(w *Widget) (draw.Drawable, error)
+
+// Build turns the layout tree into a draw.Layout, creating each leaf's widget with create
+func Build(root *Node, create WidgetFactory) (*draw.Layout, error) {
+	item, err := buildItem(root, 1.0, draw.LayoutItemRow, create)
+	if err != nil {
+		return nil, err
+	}
+	layout := draw.NewLayout()
+	layout.Set(item)
+	return layout, nil
+}
+
+// buildItem builds n as a layout item of the given type (a row of its parent's stack, or a
+// column of its parent's strip) taking ratio of the parent's space
+func buildItem(n *Node, ratio float64, kind draw.LayoutItemType, create WidgetFactory) (draw.LayoutItem, error) {
+	newItem := draw.NewLayoutRow
+	if kind == draw.LayoutItemColumn {
+		newItem = draw.NewLayoutColumn
+	}
+
+	if n.IsLeaf() {
+		widget, err := create(&n.Widget)
+		if err != nil {
+			return draw.LayoutItem{}, err
+		}
+		return newItem(ratio, widget), nil
+	}
+
+	childKind := draw.LayoutItemColumn
+	if len(n.Row) > 0 {
+		childKind = draw.LayoutItemRow
+	}
+	children := n.Children()
+	ratios := Ratios(children)
+	items := make([]interface{}, len(children))
+	for i, child := range children {
+		item, err := buildItem(child, ratios[i], childKind, create)
+		if err != nil {
+			return draw.LayoutItem{}, err
+		}
+		items[i] = item
+	}
+	return newItem(ratio, items...), nil
+}
+
+// Ratios normalizes the children's ratios to fractions summing to 1.
+// Children without a ratio get the average of the others (an equal share when none have one).
+func Ratios(children []*Node) []float64 {
+	total, given := 0.0, 0
+	for _, child := range children {
+		if child.Ratio > 0 {
+			total += child.Ratio
+			given++
+		}
+	}
+	fill := 1.0
+	if given > 0 {
+		fill = total / float64(given)
+	}
+
+	ratios := make([]float64, len(children))
+	sum := 0.0
+	for i, child := range children {
+		ratios[i] = child.Ratio
+		if ratios[i] <= 0 {
+			ratios[i] = fill
+		}
+		sum += ratios[i]
+	}
+	for i := range ratios {
+		ratios[i] /= sum
+	}
+	return ratios
+}
+
+// ParseColors resolves color names (see draw.ColorMap) or 0-255 palette indices
+func ParseColors(names []string) ([]styling.Color, error) {
+	colors := make([]styling.Color, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if c, ok := draw.ColorMap[name]; ok {
+			colors = append(colors, c)
+			continue
+		}
+		n, err := strconv.Atoi(name)
+		if err != nil || n < 0 || n > 255 {
+			return nil, fmt.Errorf("unknown color: %s", name)
+		}
+		colors = append(colors, styling.Color(n))
+	}
+	return colors, nil
+}
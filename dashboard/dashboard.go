@@ -0,0 +1,388 @@
+// Package dashboard reads declarative dashboard specs (JSON or YAML): named data sources, widgets
+// with their per-widget options, a nested row/column layout and refresh intervals. A spec is
+// checked into a repo and rebuilt with `console-viz --config team.yaml`.
+//
+// Example (YAML):
+//
+//	theme: dark
+//	sources:
+//	  sales: {file: data/sample_sales.csv, refresh: 1m}
+//	  cpu:   {metrics_url: "http://localhost:9182/metrics", refresh: 5s, history: 30m}
+//	  fleet: {targets: [web1:9100, web2:9100], metrics: [node_load1], refresh: 15s}
+//	  disk:  {exec: "df --output=pcent /", refresh: 10s}
+//	  load:  {system: cpu, refresh: 2s}
+//	  jobs:  {statsd: ":8125", refresh: 10s}
+//	  reqs:  {prometheus_url: "localhost:9090", queries: ["sum by (code) (rate(http_requests_total[5m]))"], refresh: 30s, history: 6h}
+//	layout:
+//	  row:                     # children are rows, stacked top to bottom
+//	    - ratio: 60
+//	      col:                 # children are columns, side by side
+//	        - {ratio: 70, type: barchart, source: sales, y_axis: Sales, colors: [green]}
+//	        - {ratio: 30, type: table, source: sales, columns: [Month, Sales]}
+//	    - {ratio: 40, type: plot, source: cpu, title: CPU MHz}
+//	alerts:
+//	  - "slow core: windows_cpu_core_frequency_mhz < 1000 for 2m"
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is a whole dashboard
+type Spec struct {
+	Theme   string             `json:"theme" yaml:"theme"`
+	Refresh Duration           `json:"refresh" yaml:"refresh"` // default refresh for sources without their own
+	Data    *Source            `json:"data" yaml:"data"`       // default source for widgets that don't name one
+	Sources map[string]*Source `json:"sources" yaml:"sources"` // named sources, referenced by Widget.Source
+	Layout  *Node              `json:"layout" yaml:"layout"`
+	Alerts  []string           `json:"alerts" yaml:"alerts"` // threshold rules on live sources' lines (see collector.ParseRule); a list, since a rule may contain commas
+}
+
+// Source is where widget data comes from: a data file (or "-" for stdin), metrics URLs or a command
+type Source struct {
+	File   string `json:"file" yaml:"file"`
+	Legacy string `json:"source" yaml:"source"` // older spelling of File
+	Format string `json:"format" yaml:"format"`
+
+	// delimited file options (same meaning as the CLI flags)
+	Delimiter      string `json:"delimiter" yaml:"delimiter"`
+	Comment        string `json:"comment" yaml:"comment"`
+	LazyQuotes     bool   `json:"lazy_quotes" yaml:"lazy_quotes"`
+	VariableFields bool   `json:"variable_fields" yaml:"variable_fields"`
+
+	// row/column selection and shaping, applied to every widget using the source
+	SkipRows      int        `json:"skip_rows" yaml:"skip_rows"`
+	Limit         int        `json:"limit" yaml:"limit"`
+	Rows          string     `json:"rows" yaml:"rows"`
+	Columns       StringList `json:"columns" yaml:"columns"`
+	JSONPath      string     `json:"json_path" yaml:"json_path"`
+	JSONLabelPath string     `json:"json_label_path" yaml:"json_label_path"`
+	GroupBy       StringList `json:"group_by" yaml:"group_by"`
+	Agg           string     `json:"agg" yaml:"agg"`
+
+	// live metrics
+	MetricsURL  string     `json:"metrics_url" yaml:"metrics_url"`
+	Targets     StringList `json:"targets" yaml:"targets"`           // more hosts scraped with metrics_url, overlaid in one widget
+	TargetsFile string     `json:"targets_file" yaml:"targets_file"` // file listing targets (one per line, or file_sd JSON)
+	Metrics     []string   `json:"metrics" yaml:"metrics"`
+	History     Scalar     `json:"history" yaml:"history"` // scrapes kept per line: a count (120) or a duration (1h)
+
+	// scrape auth and TLS (files are relative to the spec, like File)
+	BearerToken        string `json:"bearer_token" yaml:"bearer_token"`
+	BearerTokenFile    string `json:"bearer_token_file" yaml:"bearer_token_file"`
+	BasicAuth          string `json:"basic_auth" yaml:"basic_auth"` // user:password
+	CAFile             string `json:"ca_file" yaml:"ca_file"`
+	CertFile           string `json:"cert_file" yaml:"cert_file"`
+	KeyFile            string `json:"key_file" yaml:"key_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+
+	// command output
+	Exec    string   `json:"exec" yaml:"exec"`       // shell command run every refresh
+	Pattern string   `json:"pattern" yaml:"pattern"` // regex pulling fields out of its output
+	Timeout Duration `json:"timeout" yaml:"timeout"` // per run or scrape; 0 uses the refresh interval
+
+	// Linux system metrics from /proc and /sys
+	System string `json:"system" yaml:"system"` // view: cpu, cpufreq, memory, network or disk
+	Root   string `json:"root" yaml:"root"`     // directory holding proc and sys (default /)
+
+	// StatsD over UDP, aggregated every refresh (metrics picks and computes series)
+	StatsD string `json:"statsd" yaml:"statsd"` // address to listen on, e.g. ":8125"
+
+	// PromQL over a Prometheus-compatible API, backfilled to history and refreshed incrementally
+	// (evaluated every refresh, the query step; auth and TLS as for scrapes)
+	PrometheusURL string   `json:"prometheus_url" yaml:"prometheus_url"` // e.g. localhost:9090 or http://thanos:10902
+	Queries       []string `json:"queries" yaml:"queries"`
+
+	Refresh Duration `json:"refresh" yaml:"refresh"` // reload/scrape interval; 0 loads a file once
+}
+
+// Widget is one visualization and its options; empty options fall back to the source's
+type Widget struct {
+	Type    string     `json:"type" yaml:"type"`
+	Source  string     `json:"source" yaml:"source"` // name in Spec.Sources; "" uses Spec.Data
+	Title   string     `json:"title" yaml:"title"`
+	XAxis   string     `json:"x_axis" yaml:"x_axis"`
+	YAxis   StringList `json:"y_axis" yaml:"y_axis"`
+	Columns StringList `json:"columns" yaml:"columns"`
+	Rows    string     `json:"rows" yaml:"rows"`
+	Limit   int        `json:"limit" yaml:"limit"`
+	GroupBy StringList `json:"group_by" yaml:"group_by"`
+	Agg     string     `json:"agg" yaml:"agg"`
+	Colors  StringList `json:"colors" yaml:"colors"` // color names (red, green, ...) or 0-255 palette indices
+}
+
+// Node is one cell of the layout tree: either a widget (leaf) or a container whose children are
+// stacked as rows or placed side by side as columns. Ratios are relative to the siblings
+// (60/40 and 0.6/0.4 are the same); children without a ratio share the space equally.
+type Node struct {
+	Widget `yaml:",inline"`
+	Ratio  float64 `json:"ratio" yaml:"ratio"`
+	Row    []*Node `json:"row" yaml:"row"`         // children are rows, stacked top to bottom
+	Col    []*Node `json:"col" yaml:"col"`         // children are columns, side by side
+	List   []*Node `json:"widgets" yaml:"widgets"` // older spelling: widgets side by side
+}
+
+// IsLeaf reports whether the node is a widget rather than a container
+func (n *Node) IsLeaf() bool {
+	return len(n.Row) == 0 && len(n.Col) == 0 && len(n.List) == 0
+}
+
+// Load reads a spec from a .json, .yaml or .yml file. Relative data file paths are resolved
+// against the spec's directory so a checked-in dashboard works from any working directory.
+func Load(path string) (*Spec, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &Spec{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, spec)
+	default:
+		err = json.Unmarshal(raw, spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for _, src := range spec.allSources() {
+		if src.File == "" {
+			src.File = src.Legacy
+		}
+		if src.File != "-" {
+			src.File = resolve(dir, src.File)
+		}
+		src.TargetsFile = resolve(dir, src.TargetsFile)
+		src.Root = resolve(dir, src.Root)
+		src.BearerTokenFile = resolve(dir, src.BearerTokenFile)
+		src.CAFile = resolve(dir, src.CAFile)
+		src.CertFile = resolve(dir, src.CertFile)
+		src.KeyFile = resolve(dir, src.KeyFile)
+		if src.Refresh == 0 {
+			src.Refresh = spec.Refresh
+		}
+	}
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// allSources returns the default source (if any) and every named source
+func (s *Spec) allSources() []*Source {
+	sources := []*Source{}
+	if s.Data != nil {
+		sources = append(sources, s.Data)
+	}
+	for _, src := range s.Sources {
+		if src != nil {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+// resolve makes a relative path relative to dir (the spec's directory); "" stays ""
+func resolve(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// validate checks the layout tree and that every widget's source exists
+func (s *Spec) validate() error {
+	if s.Layout == nil {
+		return fmt.Errorf("missing layout")
+	}
+	for name, src := range s.Sources {
+		if src == nil || (src.File == "" && !src.Live()) {
+			return fmt.Errorf("source %q: needs file, metrics_url (or targets), exec, system, statsd or prometheus_url", name)
+		}
+		if (src.PrometheusURL == "") != (len(src.Queries) == 0) {
+			return fmt.Errorf("source %q: prometheus_url and queries go together", name)
+		}
+	}
+	return s.Layout.walk(func(n *Node) error {
+		containers := 0
+		for _, children := range [][]*Node{n.Row, n.Col, n.List} {
+			if len(children) > 0 {
+				containers++
+			}
+		}
+		if containers > 1 {
+			return fmt.Errorf("layout node has more than one of row, col and widgets")
+		}
+		if n.IsLeaf() {
+			if _, err := s.Source(n.Source); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// walk calls fn for n and every descendant, depth first
+func (n *Node) walk(fn func(*Node) error) error {
+	if err := fn(n); err != nil {
+		return err
+	}
+	for _, child := range n.Children() {
+		if err := child.walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Children returns a container's children (nil for a leaf)
+func (n *Node) Children() []*Node {
+	switch {
+	case len(n.Row) > 0:
+		return n.Row
+	case len(n.Col) > 0:
+		return n.Col
+	}
+	return n.List
+}
+
+// Source returns the named source, or the default one for "" (Spec.Data, or the only named source)
+func (s *Spec) Source(name string) (*Source, error) {
+	if name != "" {
+		if src, ok := s.Sources[name]; ok && src != nil {
+			return src, nil
+		}
+		return nil, fmt.Errorf("unknown source: %s", name)
+	}
+	if s.Data != nil {
+		return s.Data, nil
+	}
+	if len(s.Sources) == 1 {
+		for _, src := range s.Sources {
+			return src, nil
+		}
+	}
+	return nil, fmt.Errorf("widget has no source (set data, or source: <name>)")
+}
+
+// Scrapes reports whether the source scrapes metrics pages (metrics_url, targets or targets_file)
+func (s *Source) Scrapes() bool {
+	return s.MetricsURL != "" || len(s.Targets) > 0 || s.TargetsFile != ""
+}
+
+// Live reports whether the source feeds widgets from a collector (scrapes, a command, system
+// metrics, StatsD or PromQL) rather than a data file
+func (s *Source) Live() bool {
+	return s.Scrapes() || s.Exec != "" || s.System != "" || s.StatsD != "" || s.PrometheusURL != ""
+}
+
+// Duration is a time.Duration written as "30s"/"5m" or as a number of seconds
+type Duration time.Duration
+
+// parse accepts Go duration strings or plain (fractional) seconds
+func (d *Duration) parse(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		*d = Duration(secs * float64(time.Second))
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %s", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalJSON accepts "30s" or 30
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	return d.parse(s)
+}
+
+// UnmarshalYAML accepts 30s or 30
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	return d.parse(value.Value)
+}
+
+// Scalar is a string that may also be written as a number (e.g. history: 120 or history: 1h)
+type Scalar string
+
+// UnmarshalJSON accepts "1h" or 120
+func (v *Scalar) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	*v = Scalar(strings.TrimSpace(s))
+	return nil
+}
+
+// UnmarshalYAML accepts 1h or 120
+func (v *Scalar) UnmarshalYAML(value *yaml.Node) error {
+	*v = Scalar(strings.TrimSpace(value.Value))
+	return nil
+}
+
+// StringList is a list of strings that may also be written as a single comma-separated string
+type StringList []string
+
+// set splits a comma-separated string
+func (l *StringList) set(s string) {
+	*l = nil
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*l = append(*l, part)
+		}
+	}
+}
+
+// UnmarshalJSON accepts "a,b" or ["a", "b"]
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		l.set(s)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %s", data)
+	}
+	*l = list
+	return nil
+}
+
+// UnmarshalYAML accepts a,b or [a, b]
+func (l *StringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		l.set(value.Value)
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// String joins the list with commas (the form the CLI flags take)
+func (l StringList) String() string {
+	return strings.Join(l, ",")
+}
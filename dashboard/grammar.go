@@ -0,0 +1,141 @@
+package dashboard
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseLayout parses the --layout grammar into a layout tree whose leaves are widget types:
+//
+//	layout := node
+//	node   := "row(" item ("," item)* ")"   children stacked top to bottom
+//	        | "col(" item ("," item)* ")"   children side by side ("column(" also works)
+//	        | widget-type                   e.g. barchart, table, plot
+//	item   := [ratio ":"] node
+//
+// Example: "row(60: col(70:barchart, 30:table), 40: plot)" puts a bar chart and a table side
+// by side in the top 60% and a plot in the bottom 40%.
+func ParseLayout(expr string) (*Node, error) {
+	p := &layoutParser{src: expr}
+	node, err := p.node()
+	if err == nil {
+		p.skipSpace()
+		if p.pos < len(p.src) {
+			err = fmt.Errorf("unexpected %q", p.src[p.pos:])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("layout %q: %w", expr, err)
+	}
+	return node, nil
+}
+
+// IsLayoutExpr reports whether s uses the nested row/col grammar rather than plain ratios ("80:20")
+func IsLayoutExpr(s string) bool {
+	return strings.Contains(s, "(")
+}
+
+// layoutParser is a recursive-descent parser over the --layout grammar
+type layoutParser struct {
+	src string
+	pos int
+}
+
+func (p *layoutParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// word reads a widget type or container keyword
+func (p *layoutParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := rune(p.src[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' && c != '_' && c != '.' {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// peek returns the next non-space byte (0 at the end)
+func (p *layoutParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *layoutParser) node() (*Node, error) {
+	start := p.pos
+	name := strings.ToLower(p.word())
+	if name == "" {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return nil, fmt.Errorf("unexpected end, expected a widget or row(...)/col(...)")
+		}
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.src[p.pos], p.pos)
+	}
+	if p.peek() != '(' {
+		return &Node{Widget: Widget{Type: name}}, nil
+	}
+	if name != "row" && name != "col" && name != "column" {
+		return nil, fmt.Errorf("unknown container %q at offset %d (use row or col)", name, start)
+	}
+	p.pos++ // (
+
+	children := []*Node{}
+	for {
+		child, err := p.item()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+		switch p.peek() {
+		case ',':
+			p.pos++
+			continue
+		case ')':
+			p.pos++
+		case 0:
+			return nil, fmt.Errorf("missing ) for %s( at offset %d", name, start)
+		default:
+			return nil, fmt.Errorf("expected , or ) at offset %d", p.pos)
+		}
+		break
+	}
+
+	if name == "row" {
+		return &Node{Row: children}, nil
+	}
+	return &Node{Col: children}, nil
+}
+
+// item parses an optional "ratio:" prefix and the node after it
+func (p *layoutParser) item() (*Node, error) {
+	p.skipSpace()
+	save := p.pos
+	ratio := 0.0
+	if word := p.word(); word != "" && p.peek() == ':' {
+		r, err := strconv.ParseFloat(word, 64)
+		if err != nil || r <= 0 {
+			return nil, fmt.Errorf("invalid ratio %q at offset %d", word, save)
+		}
+		ratio = r
+		p.pos++ // :
+	} else {
+		p.pos = save
+	}
+	node, err := p.node()
+	if err != nil {
+		return nil, err
+	}
+	node.Ratio = ratio
+	return node, nil
+}
@@ -0,0 +1,244 @@
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Aggregation reduces the values of one group to a single number
+type Aggregation struct {
+	Name       string
+	percentile float64 // for pNN aggregations (0-100); 50 for median
+	reduce     func(values []float64, percentile float64) float64
+}
+
+// ParseAggregation accepts sum, avg (mean), min, max, count, median and pNN percentiles (e.g. p95, p99.9)
+func ParseAggregation(name string) (Aggregation, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "sum":
+		return Aggregation{Name: name, reduce: aggSum}, nil
+	case "avg", "mean":
+		return Aggregation{Name: "avg", reduce: aggAvg}, nil
+	case "min":
+		return Aggregation{Name: name, reduce: aggMin}, nil
+	case "max":
+		return Aggregation{Name: name, reduce: aggMax}, nil
+	case "count":
+		return Aggregation{Name: name, reduce: aggCount}, nil
+	case "median":
+		return Aggregation{Name: name, percentile: 50, reduce: aggPercentile}, nil
+	}
+	if strings.HasPrefix(name, "p") {
+		p, err := strconv.ParseFloat(name[1:], 64)
+		if err == nil && p >= 0 && p <= 100 {
+			return Aggregation{Name: name, percentile: p, reduce: aggPercentile}, nil
+		}
+	}
+	return Aggregation{}, fmt.Errorf("unknown aggregation: %s (use sum, avg, min, max, count, median or pNN)", name)
+}
+
+// Apply reduces values. An empty group sums and counts to 0; every other aggregation has no
+// value for it and returns NaN.
+func (a Aggregation) Apply(values []float64) float64 {
+	if len(values) == 0 {
+		if a.Name == "sum" || a.Name == "count" {
+			return 0
+		}
+		return math.NaN()
+	}
+	return a.reduce(values, a.percentile)
+}
+
+func aggSum(values []float64, _ float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func aggAvg(values []float64, _ float64) float64 {
+	return aggSum(values, 0) / float64(len(values))
+}
+
+func aggMin(values []float64, _ float64) float64 {
+	min := values[0]
+	for _, v := range values[1:] {
+		min = math.Min(min, v)
+	}
+	return min
+}
+
+func aggMax(values []float64, _ float64) float64 {
+	max := values[0]
+	for _, v := range values[1:] {
+		max = math.Max(max, v)
+	}
+	return max
+}
+
+func aggCount(values []float64, _ float64) float64 {
+	return float64(len(values))
+}
+
+// aggPercentile uses linear interpolation between closest ranks (same as numpy's default)
+func aggPercentile(values []float64, p float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// GroupBy groups rows by the key columns and reduces each value column with agg.
+// The result has one row per distinct key combination (in first-seen order): the key columns
+// first, then one column per value column under its original name. With no value columns
+// (or for count) a single "count" column holds the number of rows in each group.
+func (d *Dataset) GroupBy(keys []*Column, values []*Column, agg Aggregation) *Dataset {
+	type group struct {
+		key    []string
+		rows   int
+		values [][]float64 // per value column
+	}
+	groups := []*group{}
+	index := map[string]*group{}
+
+	for r := range d.Rows {
+		key := make([]string, len(keys))
+		for i, col := range keys {
+			key[i] = col.Cells[r]
+		}
+		id := strings.Join(key, "\x00")
+		g, ok := index[id]
+		if !ok {
+			g = &group{key: key, values: make([][]float64, len(values))}
+			index[id] = g
+			groups = append(groups, g)
+		}
+		g.rows++
+		for i, col := range values {
+			if col.Valid(r) {
+				g.values[i] = append(g.values[i], col.Values[r])
+			}
+		}
+	}
+
+	header := columnNamesOf(keys)
+	countOnly := len(values) == 0
+	if countOnly {
+		header = append(header, "count")
+	} else {
+		header = append(header, columnNamesOf(values)...)
+	}
+
+	rows := [][]string{header}
+	for _, g := range groups {
+		row := append([]string{}, g.key...)
+		if countOnly {
+			row = append(row, strconv.Itoa(g.rows))
+		}
+		for _, vals := range g.values {
+			// a group without a value (e.g. the average of no numbers) is left empty
+			cell := ""
+			if v := agg.Apply(vals); !math.IsNaN(v) {
+				cell = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+			row = append(row, cell)
+		}
+		rows = append(rows, row)
+	}
+
+	grouped := FromRows(rows)
+	grouped.KeyColumns = len(keys)
+	// keys stay labels even when they look numeric (e.g. grouping by year)
+	for _, col := range grouped.Columns[:len(keys)] {
+		col.Type = TypeCategorical
+		col.Failures = 0
+		col.FirstFailure = ""
+	}
+	return grouped
+}
+
+// KeyLabel returns the column to label rows of a grouped dataset: the key column itself for a
+// single key, or a synthetic column joining all keys ("EU/Widgets") for several. Nil when ungrouped.
+func (d *Dataset) KeyLabel() *Column {
+	switch {
+	case d.KeyColumns == 0:
+		return nil
+	case d.KeyColumns == 1:
+		return d.Columns[0]
+	}
+	keys := d.Columns[:d.KeyColumns]
+	cells := make([]string, len(d.Rows))
+	for r := range d.Rows {
+		parts := make([]string, len(keys))
+		for i, col := range keys {
+			parts[i] = col.Cells[r]
+		}
+		cells[r] = strings.Join(parts, "/")
+	}
+	return &Column{
+		Name:   strings.Join(columnNamesOf(keys), "/"),
+		Index:  -1,
+		Type:   TypeCategorical,
+		Cells:  cells,
+		Values: make([]float64, len(cells)),
+	}
+}
+
+// Pivot spreads value over a grid: one row per distinct rowKey value and one column per distinct
+// colKey value (both in first-seen order). Cells with no rows (or no valid value) are 0. Used to
+// feed stacked bar charts from a two-key group-by, where every pair of keys is one row; a pair
+// that repeats is an error, since adding up already aggregated values (averages, maxima) would
+// chart a number that means nothing.
+func (d *Dataset) Pivot(rowKey, colKey, value *Column) (rowLabels, colLabels []string, cells [][]float64, err error) {
+	rowIndex := map[string]int{}
+	colIndex := map[string]int{}
+	for r := range d.Rows {
+		if _, ok := rowIndex[rowKey.Cells[r]]; !ok {
+			rowIndex[rowKey.Cells[r]] = len(rowLabels)
+			rowLabels = append(rowLabels, rowKey.Cells[r])
+		}
+		if _, ok := colIndex[colKey.Cells[r]]; !ok {
+			colIndex[colKey.Cells[r]] = len(colLabels)
+			colLabels = append(colLabels, colKey.Cells[r])
+		}
+	}
+	cells = make([][]float64, len(rowLabels))
+	for i := range cells {
+		cells[i] = make([]float64, len(colLabels))
+	}
+	seen := make([][]bool, len(rowLabels))
+	for i := range seen {
+		seen[i] = make([]bool, len(colLabels))
+	}
+	for r := range d.Rows {
+		i, j := rowIndex[rowKey.Cells[r]], colIndex[colKey.Cells[r]]
+		if seen[i][j] {
+			return nil, nil, nil, fmt.Errorf("%s %q / %s %q appears more than once (group by exactly these two columns)",
+				rowKey.Name, rowKey.Cells[r], colKey.Name, colKey.Cells[r])
+		}
+		seen[i][j] = true
+		if value.Valid(r) {
+			cells[i][j] = value.Values[r]
+		}
+	}
+	return rowLabels, colLabels, cells, nil
+}
+
+// columnNamesOf returns the names of cols
+func columnNamesOf(cols []*Column) []string {
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = col.Name
+	}
+	return names
+}
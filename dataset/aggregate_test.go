@@ -0,0 +1,261 @@
+package dataset
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// orders has a region with no revenue at all (APAC), a missing revenue (EU/Gadgets/Q1) and a
+// latency that isn't a number (US)
+var orders = [][]string{
+	{"region", "product", "quarter", "revenue", "latency"},
+	{"EU", "Widgets", "Q1", "100", "10"},
+	{"EU", "Widgets", "Q2", "50", "20"},
+	{"EU", "Gadgets", "Q1", "", "30"},
+	{"EU", "Gadgets", "Q2", "25", "40"},
+	{"APAC", "Widgets", "Q1", "", "50"},
+	{"US", "Widgets", "Q1", "200", "60"},
+	{"US", "Widgets", "Q2", "300", "70"},
+	{"US", "Gadgets", "Q2", "100", "80"},
+	{"US", "Gadgets", "Q1", "120", "n/a"},
+}
+
+func TestParseAggregation(t *testing.T) {
+	tests := []struct {
+		name       string
+		want       string
+		percentile float64
+	}{
+		{"sum", "sum", 0},
+		{" AVG ", "avg", 0},
+		{"mean", "avg", 0},
+		{"median", "median", 50},
+		{"p95", "p95", 95},
+		{"p99.9", "p99.9", 99.9},
+		{"p0", "p0", 0},
+	}
+	for _, tt := range tests {
+		agg, err := ParseAggregation(tt.name)
+		if err != nil || agg.Name != tt.want || agg.percentile != tt.percentile {
+			t.Errorf("ParseAggregation(%q) = %q p%v, %v; want %q p%v", tt.name, agg.Name, agg.percentile, err, tt.want, tt.percentile)
+		}
+	}
+	for _, name := range []string{"", "total", "p101", "p-1", "px"} {
+		if _, err := ParseAggregation(name); err == nil {
+			t.Errorf("ParseAggregation(%q) = nil error", name)
+		}
+	}
+}
+
+func TestAggregationApply(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		agg    string
+		values []float64
+		want   float64
+	}{
+		{"sum", []float64{1, 2, 3.5}, 6.5},
+		{"avg", []float64{1, 2, 6}, 3},
+		{"min", []float64{3, -1, 2}, -1},
+		{"max", []float64{3, -1, 2}, 3},
+		{"count", []float64{3, -1, 2}, 3},
+		{"median", []float64{5, 1, 3}, 3},
+		{"median", []float64{4, 1, 3, 2}, 2.5}, // between the middle two
+		{"p0", []float64{4, 1, 3, 2}, 1},
+		{"p100", []float64{4, 1, 3, 2}, 4},
+		{"p90", []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110}, 100},
+		{"p95", []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, 19.05},
+		{"p99", []float64{7}, 7},
+
+		// empty groups: nothing to sum or count, and no average, extreme or percentile
+		{"sum", nil, 0},
+		{"count", nil, 0},
+		{"avg", nil, nan},
+		{"min", nil, nan},
+		{"max", nil, nan},
+		{"median", nil, nan},
+		{"p95", nil, nan},
+	}
+	for _, tt := range tests {
+		agg, err := ParseAggregation(tt.agg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := agg.Apply(tt.values)
+		if !(math.IsNaN(got) && math.IsNaN(tt.want)) && math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s(%v) = %v, want %v", tt.agg, tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []string
+		values []string
+		agg    string
+		want   [][]string // header and rows
+	}{
+		{
+			name: "sum", keys: []string{"region"}, values: []string{"revenue", "latency"}, agg: "sum",
+			want: [][]string{
+				{"region", "revenue", "latency"},
+				{"EU", "175", "100"},
+				{"APAC", "0", "50"}, // no revenue sums to 0
+				{"US", "720", "210"},
+			},
+		},
+		{
+			name: "avg of empty groups stays empty", keys: []string{"region"}, values: []string{"revenue", "latency"}, agg: "avg",
+			want: [][]string{
+				{"region", "revenue", "latency"},
+				{"EU", "58.333333333333336", "25"},
+				{"APAC", "", "50"},
+				{"US", "180", "70"}, // n/a isn't a latency
+			},
+		},
+		{
+			name: "percentile", keys: []string{"region"}, values: []string{"revenue"}, agg: "p50",
+			want: [][]string{
+				{"region", "revenue"},
+				{"EU", "50"},
+				{"APAC", ""},
+				{"US", "160"},
+			},
+		},
+		{
+			name: "count", keys: []string{"region"}, agg: "count",
+			want: [][]string{
+				{"region", "count"},
+				{"EU", "4"},
+				{"APAC", "1"},
+				{"US", "4"},
+			},
+		},
+		{
+			name: "two keys", keys: []string{"region", "product"}, values: []string{"revenue"}, agg: "max",
+			want: [][]string{
+				{"region", "product", "revenue"},
+				{"EU", "Widgets", "100"},
+				{"EU", "Gadgets", "25"},
+				{"APAC", "Widgets", ""},
+				{"US", "Widgets", "300"},
+				{"US", "Gadgets", "120"},
+			},
+		},
+	}
+	ds := FromRows(orders)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg, err := ParseAggregation(tt.agg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			grouped := ds.GroupBy(columns(t, ds, tt.keys), columns(t, ds, tt.values), agg)
+			got := [][]string{grouped.Headers}
+			for _, row := range grouped.Rows {
+				got = append(got, row)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GroupBy =\n%v\nwant\n%v", got, tt.want)
+			}
+			if grouped.KeyColumns != len(tt.keys) {
+				t.Errorf("KeyColumns = %d, want %d", grouped.KeyColumns, len(tt.keys))
+			}
+			for i, col := range grouped.Columns {
+				if keyCol := i < len(tt.keys); keyCol != (col.Type == TypeCategorical) {
+					t.Errorf("column %s is %s", col.Name, col.Type)
+				}
+			}
+			// an empty group is a missing value, not a 0 that charts would draw
+			for _, col := range grouped.Columns[len(tt.keys):] {
+				for r, cell := range col.Cells {
+					if col.Valid(r) == (cell == "") {
+						t.Errorf("%s row %d: Valid = %v for %q", col.Name, r, col.Valid(r), cell)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestKeyLabel(t *testing.T) {
+	ds := FromRows(orders)
+	if ds.KeyLabel() != nil {
+		t.Error("ungrouped data has a key label")
+	}
+	sum, _ := ParseAggregation("sum")
+	grouped := ds.GroupBy(columns(t, ds, []string{"region", "product"}), columns(t, ds, []string{"revenue"}), sum)
+	label := grouped.KeyLabel()
+	if label.Name != "region/product" || strings.Join(label.Cells, " ") != "EU/Widgets EU/Gadgets APAC/Widgets US/Widgets US/Gadgets" {
+		t.Errorf("KeyLabel = %s %v", label.Name, label.Cells)
+	}
+}
+
+func TestPivot(t *testing.T) {
+	ds := FromRows(orders)
+	tests := []struct {
+		name    string
+		keys    []string
+		agg     string
+		rows    []string
+		cols    []string
+		cells   [][]float64
+		wantErr bool
+	}{
+		{
+			name: "sum", keys: []string{"region", "product"}, agg: "sum",
+			rows: []string{"EU", "APAC", "US"}, cols: []string{"Widgets", "Gadgets"},
+			cells: [][]float64{{150, 25}, {0, 0}, {500, 220}},
+		},
+		{
+			// APAC/Widgets has no average; it stacks nothing
+			name: "avg", keys: []string{"region", "product"}, agg: "avg",
+			rows: []string{"EU", "APAC", "US"}, cols: []string{"Widgets", "Gadgets"},
+			cells: [][]float64{{75, 25}, {0, 0}, {250, 110}},
+		},
+		{
+			// a third key repeats region/product pairs: their averages can't be added up
+			name: "three keys", keys: []string{"region", "product", "quarter"}, agg: "avg", wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg, err := ParseAggregation(tt.agg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			grouped := ds.GroupBy(columns(t, ds, tt.keys), columns(t, ds, []string{"revenue"}), agg)
+			value := grouped.Columns[len(tt.keys)]
+			rows, cols, cells, err := grouped.Pivot(grouped.Columns[0], grouped.Columns[1], value)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error for repeated pairs")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rows, tt.rows) || !reflect.DeepEqual(cols, tt.cols) || !reflect.DeepEqual(cells, tt.cells) {
+				t.Errorf("Pivot = %v %v %v, want %v %v %v", rows, cols, cells, tt.rows, tt.cols, tt.cells)
+			}
+		})
+	}
+}
+
+// columns looks up columns by name
+func columns(t *testing.T, ds *Dataset, names []string) []*Column {
+	t.Helper()
+	var cols []*Column
+	for _, name := range names {
+		col, err := ds.Column(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
@@ -0,0 +1,296 @@
+// Package dataset turns loaded tabular data (a header row plus string cells) into typed columns.
+// Each column's type is inferred once (integer, float, percentage, boolean, timestamp or categorical),
+// numeric values are parsed up front, and cells that don't fit the inferred type are counted as
+// parse failures so callers can report them instead of silently dropping or zeroing values.
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType is the inferred type of a column
+type ColumnType int
+
+const (
+	TypeCategorical ColumnType = iota // free text / labels
+	TypeInteger                       // whole numbers, e.g. 42
+	TypeFloat                         // decimal numbers, e.g. 3.14
+	TypePercentage                    // numbers with a % suffix, e.g. 12.5%
+	TypeBoolean                       // true/false, yes/no
+	TypeTimestamp                     // dates and date-times, e.g. 2024-01-31 or RFC 3339
+)
+
+// String returns the lowercase type name (used in reports and --help text)
+func (t ColumnType) String() string {
+	switch t {
+	case TypeInteger:
+		return "integer"
+	case TypeFloat:
+		return "float"
+	case TypePercentage:
+		return "percentage"
+	case TypeBoolean:
+		return "boolean"
+	case TypeTimestamp:
+		return "timestamp"
+	}
+	return "categorical"
+}
+
+// IsNumeric reports whether values of this type can be charted as magnitudes
+func (t ColumnType) IsNumeric() bool {
+	return t == TypeInteger || t == TypeFloat || t == TypePercentage
+}
+
+// inferThreshold is the share of non-empty cells that must parse as a type for the column to get it;
+// the rest are reported as parse failures
+const inferThreshold = 0.8
+
+// timestampLayouts are the date/time formats we recognise, most specific first
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006/01/02",
+	"01/02/2006 15:04:05",
+	"01/02/2006",
+	"02 Jan 2006",
+	"Jan 2, 2006",
+	time.RFC1123,
+}
+
+// Column is one typed column of a dataset
+type Column struct {
+	Name   string
+	Index  int
+	Type   ColumnType
+	Values []float64 // parsed value per row (NaN where the cell is empty or failed to parse); timestamps are Unix seconds, booleans 0/1
+	Cells  []string  // raw cell per row ("" when the row was short)
+
+	Empty        int    // empty cells
+	Failures     int    // non-empty cells that didn't parse as Type
+	FirstFailure string // example of a failed cell, for error messages
+}
+
+// Valid reports whether row i holds a usable value of the column's type
+func (c *Column) Valid(i int) bool {
+	if c.Type == TypeCategorical {
+		return i < len(c.Cells) && c.Cells[i] != ""
+	}
+	return i < len(c.Values) && !math.IsNaN(c.Values[i])
+}
+
+// Dataset is a header plus typed columns over the same rows
+type Dataset struct {
+	Headers []string
+	Rows    [][]string // data rows (header excluded)
+	Columns []*Column
+
+	KeyColumns int // number of leading group-by key columns (0 for ungrouped data)
+}
+
+// FromRows builds a dataset from rows whose first row is the header, inferring every column's type.
+// Short rows are padded with empty cells; extra cells beyond the header get generated column names.
+func FromRows(rows [][]string) *Dataset {
+	ds := &Dataset{}
+	if len(rows) == 0 {
+		return ds
+	}
+	ds.Headers = append([]string{}, rows[0]...)
+	ds.Rows = rows[1:]
+
+	width := len(ds.Headers)
+	for _, row := range ds.Rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	for len(ds.Headers) < width {
+		ds.Headers = append(ds.Headers, fmt.Sprintf("column%d", len(ds.Headers)+1))
+	}
+
+	for i, name := range ds.Headers {
+		cells := make([]string, len(ds.Rows))
+		for r, row := range ds.Rows {
+			if i < len(row) {
+				cells[r] = strings.TrimSpace(row[i])
+			}
+		}
+		ds.Columns = append(ds.Columns, inferColumn(name, i, cells))
+	}
+	return ds
+}
+
+// inferColumn picks the narrowest type most cells agree on and parses every cell as that type
+func inferColumn(name string, index int, cells []string) *Column {
+	col := &Column{Name: name, Index: index, Cells: cells, Type: TypeCategorical}
+
+	counts := map[ColumnType]int{}
+	nonEmpty := 0
+	for _, cell := range cells {
+		if cell == "" {
+			col.Empty++
+			continue
+		}
+		nonEmpty++
+		for _, t := range cellTypes(cell) {
+			counts[t]++
+		}
+	}
+
+	if nonEmpty > 0 {
+		need := int(math.Ceil(float64(nonEmpty) * inferThreshold))
+		// integer before float so whole-number columns stay integers, but only when no numeric
+		// cell has a fraction (10, 12, 9.99 is a float column); float also accepts integers
+		for _, t := range []ColumnType{TypeBoolean, TypeInteger, TypeFloat, TypePercentage, TypeTimestamp} {
+			if t == TypeInteger && counts[TypeInteger] < counts[TypeFloat] {
+				continue
+			}
+			if counts[t] >= need {
+				col.Type = t
+				break
+			}
+		}
+	}
+
+	col.Values = make([]float64, len(cells))
+	for i, cell := range cells {
+		col.Values[i] = math.NaN()
+		if cell == "" || col.Type == TypeCategorical {
+			continue
+		}
+		if v, ok := ParseAs(col.Type, cell); ok {
+			col.Values[i] = v
+		} else {
+			col.Failures++
+			if col.FirstFailure == "" {
+				col.FirstFailure = cell
+			}
+		}
+	}
+	return col
+}
+
+// cellTypes lists every type a single cell could be (an integer cell is also a valid float)
+func cellTypes(cell string) []ColumnType {
+	types := []ColumnType{}
+	for _, t := range []ColumnType{TypeBoolean, TypeInteger, TypeFloat, TypePercentage, TypeTimestamp} {
+		if _, ok := ParseAs(t, cell); ok {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// ParseAs parses one cell as the given type, returning its numeric value
+// (percentages keep their displayed scale, e.g. "12.5%" => 12.5; timestamps are Unix seconds)
+func ParseAs(t ColumnType, cell string) (float64, bool) {
+	cell = strings.TrimSpace(cell)
+	switch t {
+	case TypeInteger:
+		n, err := strconv.ParseInt(cell, 10, 64)
+		return float64(n), err == nil
+	case TypeFloat:
+		f, err := strconv.ParseFloat(cell, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, false
+		}
+		return f, true
+	case TypePercentage:
+		if !strings.HasSuffix(cell, "%") {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(cell, "%")), 64)
+		return f, err == nil
+	case TypeBoolean:
+		switch strings.ToLower(cell) {
+		case "true", "yes", "y":
+			return 1, true
+		case "false", "no", "n":
+			return 0, true
+		}
+		return 0, false
+	case TypeTimestamp:
+		for _, layout := range timestampLayouts {
+			if ts, err := time.Parse(layout, cell); err == nil {
+				return float64(ts.Unix()), true
+			}
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// Column looks up a column by name (exact, then case-insensitive) or 1-based index
+func (d *Dataset) Column(spec string) (*Column, error) {
+	spec = strings.TrimSpace(spec)
+	for _, col := range d.Columns {
+		if col.Name == spec {
+			return col, nil
+		}
+	}
+	for _, col := range d.Columns {
+		if strings.EqualFold(col.Name, spec) {
+			return col, nil
+		}
+	}
+	if idx, err := strconv.Atoi(spec); err == nil {
+		if idx >= 1 && idx <= len(d.Columns) {
+			return d.Columns[idx-1], nil
+		}
+		return nil, fmt.Errorf("column index out of range: %d (have %d columns)", idx, len(d.Columns))
+	}
+	return nil, fmt.Errorf("column not found: %s", spec)
+}
+
+// NumericColumns returns the columns that can be charted as values, in order
+func (d *Dataset) NumericColumns() []*Column {
+	cols := []*Column{}
+	for _, col := range d.Columns {
+		if col.Type.IsNumeric() {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// LabelColumn returns the first categorical or timestamp column (the natural x-axis / bar labels),
+// or nil if every column is numeric
+func (d *Dataset) LabelColumn() *Column {
+	for _, col := range d.Columns {
+		if col.Type == TypeCategorical || col.Type == TypeTimestamp {
+			return col
+		}
+	}
+	return nil
+}
+
+// ParseErrors describes each column with parse failures, e.g.
+// `column "Sales" (integer): 2 of 12 values failed to parse (e.g. "n/a")`
+func (d *Dataset) ParseErrors() []string {
+	msgs := []string{}
+	for _, col := range d.Columns {
+		if col.Failures == 0 {
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf("column %q (%s): %d of %d values failed to parse (e.g. %q)",
+			col.Name, col.Type, col.Failures, len(col.Cells)-col.Empty, col.FirstFailure))
+	}
+	return msgs
+}
+
+// Schema describes every column as "name:type", e.g. [Month:categorical Sales:integer]
+func (d *Dataset) Schema() []string {
+	out := make([]string, len(d.Columns))
+	for i, col := range d.Columns {
+		out[i] = col.Name + ":" + col.Type.String()
+	}
+	return out
+}
@@ -2,6 +2,9 @@ package draw
 
 import (
 	"console-viz/styling"
+	"os"
+	"runtime"
+
 	tb "github.com/nsf/termbox-go"
 )
 
@@ -23,6 +26,22 @@ func Close() {
 	tb.Close()
 }
 
+// Bell rings the terminal bell. termbox draws on the terminal itself (/dev/tty, or CONOUT$ on
+// Windows), not on stdout, so the bell goes there too and still rings when stdout is redirected
+func Bell() error {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONOUT$"
+	}
+	tty, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	_, err = tty.Write([]byte("\a"))
+	return err
+}
+
 // TerminalDimensions returns the current terminal width and height
 // Syncs termbox state first to ensure accurate dimensions
 func TerminalDimensions() (int, int) {
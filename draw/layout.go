@@ -258,6 +258,14 @@ func (l *Layout) AddItem(
 	l.Items = append(l.Items, item)
 }
 
+// SetRect sets the layout's rectangle; without a border the children get all of it (no inset)
+func (l *Layout) SetRect(x1, y1, x2, y2 int) {
+	l.Base.SetRect(x1, y1, x2, y2)
+	if !l.Border {
+		l.Inner = l.Rectangle
+	}
+}
+
 // Draw renders the layout and all its child widgets
 func (l *Layout) Draw(buf *Buffer) {
 	l.Base.Draw(buf) // Draw base (border, background, etc.)
@@ -309,6 +317,18 @@ func (l *Layout) Draw(buf *Buffer) {
 	}
 }
 
+// Replace swaps widget old for new in place (e.g. after reloading its data), keeping its position
+// Returns false if old is not in the layout
+func (l *Layout) Replace(old, new Drawable) bool {
+	for _, item := range l.Items {
+		if item.Entry == old {
+			item.Entry = new
+			return true
+		}
+	}
+	return false
+}
+
 // Clear removes all items from the layout
 func (l *Layout) Clear() {
 	l.Items = make([]*LayoutItem, 0)
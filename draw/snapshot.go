@@ -0,0 +1,95 @@
+package draw
+
+import (
+	"bufio"
+	"console-viz/styling"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+
+	rw "github.com/mattn/go-runewidth"
+)
+
+// Snapshot draws items into a width x height buffer and writes it to out as text, one line per row,
+// without touching the terminal (works with no TTY, e.g. in CI logs).
+// With color the cells' styles are written as ANSI escape sequences; without it blank cells with a
+// background color are written as blocks (so bars still show) and trailing spaces are trimmed.
+func Snapshot(out io.Writer, width, height int, color bool, items ...Drawable) error {
+	buf := NewBuffer(image.Rect(0, 0, width, height))
+	for _, item := range items {
+		item.Lock()
+		item.Draw(buf)
+		item.Unlock()
+	}
+
+	w := bufio.NewWriter(out)
+	for y := 0; y < height; y++ {
+		var line strings.Builder
+		current := styling.StyleClear
+		for x := 0; x < width; x++ {
+			cell := buf.GetCell(image.Pt(x, y))
+			if cell.Rune == 0 {
+				cell = CellClear
+			}
+			if color && cell.Style != current {
+				line.WriteString(ansiStyle(cell.Style))
+				current = cell.Style
+			}
+			if !color && cell.Rune == ' ' && cell.Style.Fg == styling.ColorClear && cell.Style.Bg != styling.ColorClear {
+				// bars and gauges are blank cells with only a background color: draw them as blocks
+				cell.Rune = '█'
+			}
+			line.WriteRune(cell.Rune)
+			// a wide rune covers the next cell too
+			if rw.RuneWidth(cell.Rune) == 2 {
+				x++
+			}
+		}
+		text := line.String()
+		if color {
+			if current != styling.StyleClear {
+				text += "\x1b[0m"
+			}
+		} else {
+			text = strings.TrimRight(text, " ")
+		}
+		if _, err := w.WriteString(text + "\n"); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// ansiStyle returns the SGR escape sequence selecting style (reset first, so styles don't accumulate)
+func ansiStyle(style styling.Style) string {
+	codes := []string{"0"}
+	if style.Modifier&styling.ModifierBold != 0 {
+		codes = append(codes, "1")
+	}
+	if style.Modifier&styling.ModifierUnderline != 0 {
+		codes = append(codes, "4")
+	}
+	if style.Modifier&styling.ModifierReverse != 0 {
+		codes = append(codes, "7")
+	}
+	if style.Fg != styling.ColorClear {
+		codes = append(codes, ansiColor(style.Fg, 30, 90, "38"))
+	}
+	if style.Bg != styling.ColorClear {
+		codes = append(codes, ansiColor(style.Bg, 40, 100, "48"))
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// ansiColor encodes a palette color: the 8 basic and 8 bright colors use their short codes,
+// the rest of the 256-color palette uses the extended "38;5;n" / "48;5;n" form
+func ansiColor(c styling.Color, base, bright int, extended string) string {
+	switch {
+	case c < 8:
+		return strconv.Itoa(base + int(c))
+	case c < 16:
+		return strconv.Itoa(bright + int(c) - 8)
+	}
+	return extended + ";5;" + strconv.Itoa(int(c))
+}
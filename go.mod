@@ -6,4 +6,5 @@ require (
 	github.com/mattn/go-runewidth v0.0.9
 	github.com/mitchellh/go-wordwrap v1.0.1
 	github.com/nsf/termbox-go v1.1.1
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,222 @@
+package jsonpath
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// filterExpr is the body of a [?(...)] filter: an OR of ANDs of comparisons
+type filterExpr struct {
+	any [][]comparison
+}
+
+// comparison is "left op right", or just "left" (truthiness) when op is empty
+type comparison struct {
+	left  operand
+	op    string
+	right operand
+}
+
+// operand is either a path relative to the current element (@...) or a literal
+type operand struct {
+	path    *Path
+	literal interface{}
+}
+
+// comparisonOps are checked longest first so "<=" isn't read as "<"
+var comparisonOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseFilter parses e.g. `@.active`, `@.price < 10 && @.name != 'x'`, `@.a || @.b`
+func parseFilter(src string) (*filterExpr, error) {
+	f := &filterExpr{}
+	for _, orPart := range splitOutsideQuotes(src, "||") {
+		conj := []comparison{}
+		for _, andPart := range splitOutsideQuotes(orPart, "&&") {
+			c, err := parseComparison(strings.TrimSpace(andPart))
+			if err != nil {
+				return nil, err
+			}
+			conj = append(conj, c)
+		}
+		f.any = append(f.any, conj)
+	}
+	return f, nil
+}
+
+// parseComparison parses one comparison term
+func parseComparison(src string) (comparison, error) {
+	if src == "" {
+		return comparison{}, fmt.Errorf("empty filter expression")
+	}
+	for _, op := range comparisonOps {
+		parts := splitOutsideQuotes(src, op)
+		if len(parts) == 2 {
+			left, err := parseOperand(strings.TrimSpace(parts[0]))
+			if err != nil {
+				return comparison{}, err
+			}
+			right, err := parseOperand(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return comparison{}, err
+			}
+			return comparison{left: left, op: op, right: right}, nil
+		}
+	}
+	left, err := parseOperand(src)
+	if err != nil {
+		return comparison{}, err
+	}
+	return comparison{left: left}, nil
+}
+
+// parseOperand parses @-relative paths and literals (numbers, quoted strings, true/false/null)
+func parseOperand(src string) (operand, error) {
+	switch {
+	case strings.HasPrefix(src, "@"):
+		p, err := Compile("$" + src[1:])
+		if err != nil {
+			return operand{}, err
+		}
+		return operand{path: p}, nil
+	case isQuoted(src):
+		return operand{literal: src[1 : len(src)-1]}, nil
+	case src == "true":
+		return operand{literal: true}, nil
+	case src == "false":
+		return operand{literal: false}, nil
+	case src == "null":
+		return operand{literal: nil}, nil
+	}
+	n, err := strconv.ParseFloat(src, 64)
+	if err != nil {
+		return operand{}, fmt.Errorf("invalid filter operand: %s", src)
+	}
+	return operand{literal: n}, nil
+}
+
+// value resolves the operand against the current element (first match for paths, nil if none)
+func (o operand) value(node interface{}) interface{} {
+	if o.path == nil {
+		return o.literal
+	}
+	matches := o.path.Find(node)
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[0]
+}
+
+// eval returns true/false for the whole filter on one element
+func (f *filterExpr) eval(node interface{}) bool {
+	for _, conj := range f.any {
+		all := true
+		for _, c := range conj {
+			if !c.eval(node) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// eval applies the comparison to one element
+func (c comparison) eval(node interface{}) bool {
+	left := c.left.value(node)
+	if c.op == "" {
+		// a bare path tests existence/truthiness; [?(@.active)] keeps elements whose active is true
+		return truthy(left)
+	}
+	right := c.right.value(node)
+	switch c.op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	}
+	cmp, ok := compare(left, right)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// equal compares values; numbers and numeric strings compare numerically, arrays and objects
+// element by element (== on them would panic)
+func equal(a, b interface{}) bool {
+	if cmp, ok := compare(a, b); ok {
+		return cmp == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders two numbers or two strings; ok is false for anything else
+func compare(a, b interface{}) (int, bool) {
+	af, aNum := toNumber(a)
+	bf, bNum := toNumber(b)
+	if aNum && bNum {
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+	as, aStr := a.(string)
+	bs, bStr := b.(string)
+	if aStr && bStr {
+		return strings.Compare(as, bs), true
+	}
+	return 0, false
+}
+
+// toNumber converts JSON numbers (and strings holding numbers) to float64
+func toNumber(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// splitOutsideQuotes splits s on sep, ignoring separators inside quoted strings
+func splitOutsideQuotes(s, sep string) []string {
+	parts := []string{}
+	var quote byte
+	last := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[last:i])
+			i += len(sep) - 1
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
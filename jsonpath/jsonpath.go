@@ -0,0 +1,374 @@
+// Package jsonpath evaluates JSONPath-style expressions against decoded JSON (the interface{} values
+// produced by encoding/json), so callers can pick exactly which values of a document to chart.
+//
+// Supported syntax:
+//
+//	$                  root
+//	.name  ['name']    child field
+//	.*  [*]            all children (array elements or object values)
+//	[2]  [-1]          array index (negative counts from the end)
+//	[1:3]  [:2]        array slice
+//	..name             recursive descent
+//	[?(@.active)]      filter: keep elements where the expression is truthy
+//	[?(@.price < 10 && @.name != 'x')]
+package jsonpath
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled JSONPath expression
+type Path struct {
+	expr  string
+	steps []step
+}
+
+// stepKind identifies what a single path step does
+type stepKind int
+
+const (
+	stepField     stepKind = iota // .name or ['name']
+	stepWildcard                  // .* or [*]
+	stepIndex                     // [n]
+	stepSlice                     // [start:end]
+	stepRecursive                 // ..name or ..*
+	stepFilter                    // [?(...)]
+)
+
+// step is one segment of a compiled path
+type step struct {
+	kind   stepKind
+	name   string // field name (stepField, stepRecursive; "*" for recursive wildcard)
+	index  int
+	start  *int // slice bounds; nil means open
+	end    *int
+	filter *filterExpr
+}
+
+// Compile parses a JSONPath expression. A leading "$" is optional.
+func Compile(expr string) (*Path, error) {
+	p := &parser{src: strings.TrimSpace(expr)}
+	steps, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("jsonpath %q: %w", expr, err)
+	}
+	return &Path{expr: expr, steps: steps}, nil
+}
+
+// MustCompile is like Compile but panics on error (for expressions known at compile time)
+func MustCompile(expr string) *Path {
+	p, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the original expression
+func (p *Path) String() string {
+	return p.expr
+}
+
+// LastField returns the last named field in the path (e.g. "value" for $.categories[*].value),
+// or "" if the path doesn't end in a field. Useful as a column header for the selected values.
+func (p *Path) LastField() string {
+	for i := len(p.steps) - 1; i >= 0; i-- {
+		s := p.steps[i]
+		if (s.kind == stepField || s.kind == stepRecursive) && s.name != "*" {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// Find returns every value in doc matched by the path, in document order
+// (object keys are visited in sorted order so results are deterministic).
+func (p *Path) Find(doc interface{}) []interface{} {
+	current := []interface{}{doc}
+	for _, s := range p.steps {
+		next := []interface{}{}
+		for _, node := range current {
+			next = s.apply(node, next)
+		}
+		current = next
+	}
+	return current
+}
+
+// apply appends the results of this step on node to out
+func (s step) apply(node interface{}, out []interface{}) []interface{} {
+	switch s.kind {
+	case stepField:
+		if obj, ok := node.(map[string]interface{}); ok {
+			if v, exists := obj[s.name]; exists {
+				out = append(out, v)
+			}
+		}
+	case stepWildcard:
+		out = append(out, children(node)...)
+	case stepIndex:
+		if arr, ok := node.([]interface{}); ok {
+			i := s.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i >= 0 && i < len(arr) {
+				out = append(out, arr[i])
+			}
+		}
+	case stepSlice:
+		if arr, ok := node.([]interface{}); ok {
+			start, end := 0, len(arr)
+			if s.start != nil {
+				start = clampIndex(*s.start, len(arr))
+			}
+			if s.end != nil {
+				end = clampIndex(*s.end, len(arr))
+			}
+			for i := start; i < end; i++ {
+				out = append(out, arr[i])
+			}
+		}
+	case stepRecursive:
+		out = s.descend(node, out)
+	case stepFilter:
+		for _, child := range children(node) {
+			if s.filter.eval(child) {
+				out = append(out, child)
+			}
+		}
+	}
+	return out
+}
+
+// descend implements ".." by matching the field (or everything for "*") at every depth
+func (s step) descend(node interface{}, out []interface{}) []interface{} {
+	if s.name == "*" {
+		for _, child := range children(node) {
+			out = append(out, child)
+			out = s.descend(child, out)
+		}
+		return out
+	}
+	if obj, ok := node.(map[string]interface{}); ok {
+		if v, exists := obj[s.name]; exists {
+			out = append(out, v)
+		}
+	}
+	for _, child := range children(node) {
+		out = s.descend(child, out)
+	}
+	return out
+}
+
+// children returns array elements or object values (sorted by key)
+func children(node interface{}) []interface{} {
+	switch val := node.(type) {
+	case []interface{}:
+		return val
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			out = append(out, val[k])
+		}
+		return out
+	}
+	return nil
+}
+
+// clampIndex resolves a possibly negative slice bound against length n
+func clampIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+// truthy follows JavaScript-ish rules: nil, false, 0 and "" are false; everything else is true
+func truthy(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return val
+	case float64:
+		return val != 0
+	case string:
+		return val != ""
+	}
+	return true
+}
+
+// parser turns an expression string into steps
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) parse() ([]step, error) {
+	if strings.HasPrefix(p.src, "$") {
+		p.pos = 1
+	}
+	steps := []step{}
+	for p.pos < len(p.src) {
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], ".."):
+			p.pos += 2
+			if p.pos < len(p.src) && p.src[p.pos] == '[' {
+				// ..[*] behaves like ..*
+				s, err := p.parseBracket()
+				if err != nil {
+					return nil, err
+				}
+				if s.kind != stepWildcard {
+					return nil, fmt.Errorf("only ..* or ..name supported at offset %d", p.pos)
+				}
+				steps = append(steps, step{kind: stepRecursive, name: "*"})
+				continue
+			}
+			name := p.readName()
+			if name == "" {
+				return nil, fmt.Errorf("expected field name after .. at offset %d", p.pos)
+			}
+			steps = append(steps, step{kind: stepRecursive, name: name})
+		case p.src[p.pos] == '.':
+			p.pos++
+			name := p.readName()
+			switch name {
+			case "":
+				return nil, fmt.Errorf("expected field name after . at offset %d", p.pos)
+			case "*":
+				steps = append(steps, step{kind: stepWildcard})
+			default:
+				steps = append(steps, step{kind: stepField, name: name})
+			}
+		case p.src[p.pos] == '[':
+			s, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, s)
+		default:
+			// allow a bare leading field ("items[*].name" is the same as "$.items[*].name")
+			if len(steps) == 0 {
+				name := p.readName()
+				if name != "" {
+					steps = append(steps, step{kind: stepField, name: name})
+					continue
+				}
+			}
+			return nil, fmt.Errorf("unexpected %q at offset %d", p.src[p.pos], p.pos)
+		}
+	}
+	return steps, nil
+}
+
+// readName reads a dot-notation field name (or "*")
+func (p *parser) readName() string {
+	if p.pos < len(p.src) && p.src[p.pos] == '*' {
+		p.pos++
+		return "*"
+	}
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] != '.' && p.src[p.pos] != '[' {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// parseBracket parses one [...] step starting at '['
+func (p *parser) parseBracket() (step, error) {
+	end := matchingBracket(p.src, p.pos)
+	if end == -1 {
+		return step{}, fmt.Errorf("unclosed [ at offset %d", p.pos)
+	}
+	inner := strings.TrimSpace(p.src[p.pos+1 : end])
+	p.pos = end + 1
+
+	switch {
+	case inner == "*":
+		return step{kind: stepWildcard}, nil
+	case strings.HasPrefix(inner, "?"):
+		body := strings.TrimSpace(inner[1:])
+		if !strings.HasPrefix(body, "(") || !strings.HasSuffix(body, ")") {
+			return step{}, fmt.Errorf("filter must look like [?(...)]: %s", inner)
+		}
+		f, err := parseFilter(body[1 : len(body)-1])
+		if err != nil {
+			return step{}, err
+		}
+		return step{kind: stepFilter, filter: f}, nil
+	case isQuoted(inner):
+		return step{kind: stepField, name: inner[1 : len(inner)-1]}, nil
+	case strings.Contains(inner, ":"):
+		parts := strings.SplitN(inner, ":", 2)
+		s := step{kind: stepSlice}
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return step{}, fmt.Errorf("invalid slice bound: %s", part)
+			}
+			if i == 0 {
+				s.start = &n
+			} else {
+				s.end = &n
+			}
+		}
+		return s, nil
+	default:
+		n, err := strconv.Atoi(inner)
+		if err != nil {
+			return step{}, fmt.Errorf("invalid index: %s", inner)
+		}
+		return step{kind: stepIndex, index: n}, nil
+	}
+}
+
+// matchingBracket returns the index of the ']' closing the '[' at open, skipping quoted strings
+// and nested brackets inside filters
+func matchingBracket(s string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// isQuoted reports whether s is wrapped in matching single or double quotes
+func isQuoted(s string) bool {
+	return len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]
+}
@@ -0,0 +1,146 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const store = `{
+	"store": {
+		"book": [
+			{"title": "Sayings", "price": 8.95, "tags": ["old"], "meta": {"isbn": "1"}},
+			{"title": "Sword", "price": 12.99, "tags": ["new"], "meta": {"isbn": "2"}, "active": true},
+			{"title": "Moby", "price": "8.99", "tags": ["old"], "meta": {"isbn": "1"}, "active": false},
+			{"title": "Rings", "price": 22.99, "tags": [], "isbn": null}
+		],
+		"bicycle": {"color": "red", "price": 19.95}
+	},
+	"items": [
+		{"a": [1], "b": [1]},
+		{"a": [1], "b": [2]},
+		{"a": {"x": 1}, "b": {"x": 1}},
+		{"a": 1, "b": [1]}
+	]
+}`
+
+func TestFind(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(store), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string // JSON of the matches
+	}{
+		{path: "$.store.bicycle.color", want: `["red"]`},
+		{path: "store.bicycle['color']", want: `["red"]`},
+		{path: "$.store.book[0].title", want: `["Sayings"]`},
+		{path: "$.store.book[-1].title", want: `["Rings"]`},
+		{path: "$.store.book[9].title", want: `[]`},
+		{path: "$.store.book[1:3].title", want: `["Sword","Moby"]`},
+		{path: "$.store.book[:2].title", want: `["Sayings","Sword"]`},
+		{path: "$.store.book[-2:].title", want: `["Moby","Rings"]`},
+		{path: "$.store.book[*].title", want: `["Sayings","Sword","Moby","Rings"]`},
+		{path: "$.store.bicycle.*", want: `["red",19.95]`}, // object values by key
+		{path: "$..price", want: `[19.95,8.95,12.99,"8.99",22.99]`},
+		{path: "$.store..isbn", want: `["1","2","1",null]`},
+		{path: "$.store.bicycle..*", want: `["red",19.95]`},
+		{path: "$.store.book.title", want: `[]`}, // a field of an array matches nothing
+
+		// filters
+		{path: "$.store.book[?(@.active)].title", want: `["Sword"]`},
+		{path: "$.store.book[?(@.price < 10)].title", want: `["Sayings","Moby"]`}, // numeric strings compare as numbers
+		{path: "$.store.book[?(@.price >= 12.99 && @.title != 'Rings')].title", want: `["Sword"]`},
+		{path: "$.store.book[?(@.title == 'Moby' || @.price > 20)].title", want: `["Moby","Rings"]`},
+		{path: `$.store.book[?(@.title == "Sword")].price`, want: `[12.99]`},
+		{path: "$.store.book[?(@.title > 'Rings')].title", want: `["Sayings","Sword"]`},
+		{path: "$.store.book[?(@.active == false)].title", want: `["Moby"]`},
+		{path: "$.store.book[?(@.isbn == null)].title", want: `["Sayings","Sword","Moby","Rings"]`}, // missing is null
+		{path: "$.store.book[?(@.meta.isbn == '1')].title", want: `["Sayings","Moby"]`},
+		{path: "$.store.book[?(@.title == 'a && b')].title", want: `[]`},
+
+		// comparing arrays and objects
+		{path: "$.items[?(@.a == @.b)].b", want: `[[1],{"x":1}]`},
+		{path: "$.items[?(@.a != @.b)].b", want: `[[2],[1]]`},
+		{path: "$.items[?(@.a < @.b)].b", want: `[]`}, // no order between arrays
+		{path: "$.store.book[?(@.tags == @.tags)].title", want: `["Sayings","Sword","Moby","Rings"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := Compile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Find(doc); !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("Find = %s, want %s", gotJSON, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		"$.",
+		"$..",
+		"$.a[",
+		"$.a[x]",
+		"$.a[1:x]",
+		"$.a[?@.b]",
+		"$.a[?()]",
+		"$.a[?(@.b < )]",
+		"$.a[?(@.b == nope)]",
+		"$..[0]",
+	} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%q) = nil error", expr)
+		}
+	}
+}
+
+func TestLastField(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"$.categories[*].value", "value"},
+		{"$..price", "price"},
+		{"$.a.*", "a"},
+		{"$[0]", ""},
+	}
+	for _, tt := range tests {
+		if got := MustCompile(tt.path).LastField(); got != tt.want {
+			t.Errorf("LastField(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b interface{}
+		want bool
+	}{
+		{1.0, 1.0, true},
+		{1.0, "1", true},
+		{"1.0", "1", true}, // numeric strings compare as numbers
+		{"a", "a", true},
+		{"a", 1.0, false},
+		{nil, nil, true},
+		{nil, false, false},
+		{true, true, true},
+		{[]interface{}{1.0}, []interface{}{1.0}, true},
+		{[]interface{}{1.0}, []interface{}{2.0}, false},
+		{map[string]interface{}{"x": 1.0}, map[string]interface{}{"x": 1.0}, true},
+		{map[string]interface{}{"x": 1.0}, []interface{}{1.0}, false},
+	}
+	for _, tt := range tests {
+		if got := equal(tt.a, tt.b); got != tt.want {
+			t.Errorf("equal(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -129,17 +129,17 @@ func GetMaxFloat64FromSlice(slice []float64) (float64, error) {
 // Useful for finding the maximum value across multiple data series
 // Returns an error if the slice is empty
 func GetMaxFloat64From2dSlice(slices [][]float64) (float64, error) {
-	if len(slices) == 0 {
-		return 0, fmt.Errorf("cannot get max value from empty slice")
-	}
-	max := slices[0][0]
+	max := math.Inf(-1)
 	for _, slice := range slices {
 		for _, val := range slice {
-			if val > max {
+			if val > max { // NaN never compares greater, so gaps are skipped
 				max = val
 			}
 		}
 	}
+	if math.IsInf(max, -1) {
+		return 0, fmt.Errorf("cannot get max value from empty slice")
+	}
 	return max, nil
 }
 
@@ -6,6 +6,9 @@ import (
 	"console-viz/utils"
 	"fmt"
 	"image"
+	"math"
+
+	rw "github.com/mattn/go-runewidth"
 )
 
 const (
@@ -32,12 +35,12 @@ const (
 	MarkerDot
 )
 
-// DrawDirection defines drawing direction (not fully implemented)
+// DrawDirection defines drawing direction
 type DrawDirection uint
 
 const (
-	DrawLeft DrawDirection = iota
-	DrawRight
+	DrawLeft  DrawDirection = iota // when the data is wider than the plot, keep the newest (last) points in view
+	DrawRight                      // always start from the first point; what doesn't fit is cut off on the right
 )
 
 // Plot displays line charts or scatter plots
@@ -55,6 +58,7 @@ type Plot struct {
 	PlotType       PlotType           // LineChart or ScatterPlot
 	HorizontalScale int               // Horizontal scaling factor
 	DrawDirection   DrawDirection     // Drawing direction
+	XLabels         []string          // Optional x-axis labels, one per data point (default: 1, 2, 3, ...)
 }
 
 // NewPlot creates a new Plot widget with default settings
@@ -74,8 +78,8 @@ func NewPlot() *Plot {
 	}
 }
 
-// plotAxes draws the axes and labels
-func (p *Plot) plotAxes(buf *draw.Buffer, maxVal float64) {
+// plotAxes draws the axes and labels; offset is the index of the first visible data point
+func (p *Plot) plotAxes(buf *draw.Buffer, maxVal float64, offset int) {
 	// Draw origin cell
 	buf.SetCell(
 		draw.NewCell(styling.BOTTOM_LEFT, styling.NewStyle(styling.ColorWhite)),
@@ -102,9 +106,16 @@ func (p *Plot) plotAxes(buf *draw.Buffer, maxVal float64) {
 	buf.SetString("0", styling.NewStyle(p.AxesColor), image.Pt(p.Inner.Min.X+yAxisLabelsWidth, p.Inner.Max.Y-1))
 
 	for x := p.Inner.Min.X + yAxisLabelsWidth + (xAxisLabelsGap)*p.HorizontalScale + 1; x < p.Inner.Max.X-1; {
-		label := fmt.Sprintf("%d", (x-(p.Inner.Min.X+yAxisLabelsWidth)-1)/(p.HorizontalScale)+1)
+		index := (x-(p.Inner.Min.X+yAxisLabelsWidth)-1)/(p.HorizontalScale) + offset
+		label := fmt.Sprintf("%d", index+1)
+		if len(p.XLabels) > 0 {
+			if index >= len(p.XLabels) {
+				break
+			}
+			label = p.XLabels[index]
+		}
 		buf.SetString(label, styling.NewStyle(p.AxesColor), image.Pt(x, p.Inner.Max.Y-1))
-		x += (len(label) + xAxisLabelsGap) * p.HorizontalScale
+		x += (rw.StringWidth(label) + xAxisLabelsGap) * p.HorizontalScale
 	}
 
 	// Draw y axis labels
@@ -115,14 +126,32 @@ func (p *Plot) plotAxes(buf *draw.Buffer, maxVal float64) {
 	}
 }
 
-// renderDot renders the plot using dot markers
-func (p *Plot) renderDot(buf *draw.Buffer, drawArea image.Rectangle, maxVal float64) {
+// scrollOffset returns how many leading points are scrolled out of view: with DrawLeft, enough
+// for the longest series' last point to fit in drawArea; with DrawRight, none
+func (p *Plot) scrollOffset(drawArea image.Rectangle) int {
+	if p.DrawDirection != DrawLeft || p.HorizontalScale <= 0 {
+		return 0
+	}
+	longest := 0
+	for _, line := range p.Data {
+		longest = utils.MaxInt(longest, len(line))
+	}
+	visible := (drawArea.Dx() + p.HorizontalScale - 1) / p.HorizontalScale
+	return utils.MaxInt(0, longest-visible)
+}
+
+// renderDot renders the plot using dot markers, starting at data point offset
+func (p *Plot) renderDot(buf *draw.Buffer, drawArea image.Rectangle, maxVal float64, offset int) {
 	switch p.PlotType {
 	case ScatterPlot:
 		for i, line := range p.Data {
-			for j, val := range line {
+			for j := offset; j < len(line); j++ {
+				val := line[j]
+				if math.IsNaN(val) {
+					continue // gap (e.g. a series missing from a scrape)
+				}
 				height := int((val / maxVal) * float64(drawArea.Dy()-1))
-				point := image.Pt(drawArea.Min.X+(j*p.HorizontalScale), drawArea.Max.Y-1-height)
+				point := image.Pt(drawArea.Min.X+((j-offset)*p.HorizontalScale), drawArea.Max.Y-1-height)
 				if point.In(drawArea) {
 					color := utils.SelectColor(p.LineColors, i)
 					buf.SetCell(
@@ -134,11 +163,14 @@ func (p *Plot) renderDot(buf *draw.Buffer, drawArea image.Rectangle, maxVal floa
 		}
 	case LineChart:
 		for i, line := range p.Data {
-			for j := 0; j < len(line) && j*p.HorizontalScale < drawArea.Dx(); j++ {
+			for j := offset; j < len(line) && (j-offset)*p.HorizontalScale < drawArea.Dx(); j++ {
 				val := line[j]
+				if math.IsNaN(val) {
+					continue // gap: no dot and no line to the next point
+				}
 				height := int((val / maxVal) * float64(drawArea.Dy()-1))
 				color := utils.SelectColor(p.LineColors, i)
-				point := image.Pt(drawArea.Min.X+(j*p.HorizontalScale), drawArea.Max.Y-1-height)
+				point := image.Pt(drawArea.Min.X+((j-offset)*p.HorizontalScale), drawArea.Max.Y-1-height)
 				if point.In(drawArea) {
 					buf.SetCell(
 						draw.NewCell(p.DotMarkerRune, styling.NewStyle(color)),
@@ -146,10 +178,10 @@ func (p *Plot) renderDot(buf *draw.Buffer, drawArea image.Rectangle, maxVal floa
 					)
 				}
 				// Draw line to next point
-				if j < len(line)-1 {
+				if j < len(line)-1 && !math.IsNaN(line[j+1]) {
 					nextVal := line[j+1]
 					nextHeight := int((nextVal / maxVal) * float64(drawArea.Dy()-1))
-					nextPoint := image.Pt(drawArea.Min.X+((j+1)*p.HorizontalScale), drawArea.Max.Y-1-nextHeight)
+					nextPoint := image.Pt(drawArea.Min.X+((j+1-offset)*p.HorizontalScale), drawArea.Max.Y-1-nextHeight)
 					p.drawLine(buf, point, nextPoint, color)
 				}
 			}
@@ -210,11 +242,6 @@ func (p *Plot) Draw(buf *draw.Buffer) {
 		}
 	}
 
-	// Draw axes if enabled
-	if p.ShowAxes {
-		p.plotAxes(buf, maxVal)
-	}
-
 	// Calculate draw area (shrink from right if we have a legend)
 	drawArea := p.Inner
 	if p.ShowAxes {
@@ -228,13 +255,19 @@ func (p *Plot) Draw(buf *draw.Buffer) {
 	if len(p.DataLabels) > 0 && drawArea.Dx() > legendWidth {
 		drawArea.Max.X -= legendWidth
 	}
+	offset := p.scrollOffset(drawArea)
+
+	// Draw axes if enabled
+	if p.ShowAxes {
+		p.plotAxes(buf, maxVal, offset)
+	}
 
 	// Render based on marker type
 	switch p.Marker {
 	case MarkerBraille:
-		p.renderDot(buf, drawArea, maxVal)
+		p.renderDot(buf, drawArea, maxVal, offset)
 	case MarkerDot:
-		p.renderDot(buf, drawArea, maxVal)
+		p.renderDot(buf, drawArea, maxVal, offset)
 	}
 
 	// Legend on the right: color dot + label per series (when DataLabels set, e.g. for --metric mode)